@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	"golang.org/x/net/context"
+)
+
+// actionConfirmations keeps pending disarm confirmations per sensor, it is safe for concurrent use
+type actionConfirmations struct {
+	mutex     sync.Mutex
+	requested map[string]time.Time
+}
+
+func newActionConfirmations() *actionConfirmations {
+	return &actionConfirmations{requested: make(map[string]time.Time)}
+}
+
+// confirm returns true if sensor action was already requested within window, otherwise this request is recorded
+func (confirmations *actionConfirmations) confirm(sensorName string, now time.Time, window time.Duration) bool {
+	confirmations.mutex.Lock()
+	defer confirmations.mutex.Unlock()
+	if requestedAt, requested := confirmations.requested[sensorName]; requested && now.Sub(requestedAt) <= window {
+		delete(confirmations.requested, sensorName)
+		return true
+	}
+	confirmations.requested[sensorName] = now
+	return false
+}
+
+// handleAction runs the command mapped to an action sensor action, unmapped actions are ignored
+func (s service) handleAction(ctx context.Context, sensorLog *slog.Logger, sensorName string, action string) {
+	sensor := s.config.Sensors[sensorName]
+	command, mapped := sensor.Actions[action]
+	sensorLog = sensorLog.With("action", action)
+	if !mapped {
+		sensorLog.Debug("Sensor action is not mapped to any command.")
+		return
+	}
+	// Current mode is only informative, actions never depend on alarm status being known
+	currentAlarmMode, modeErr := s.alarm.CurrentMode(sensor.Device)
+	if modeErr != nil {
+		sensorLog.Error("Failed to read alarm status.", "error", modeErr)
+	}
+	sensorLog = sensorLog.With("command", command, "mode", currentAlarmMode)
+
+	switch command {
+	case config.ActionPanic:
+		panicMessage := s.message(notifier.MessageActionPanic, notifier.MessageData{SensorID: sensorName, Device: sensor.Device, Mode: currentAlarmMode})
+		sensorLog.Warn(panicMessage)
+		s.send(notifier.Event{Type: notifier.EventAction, Message: panicMessage, Priority: highPriority, Sensor: sensorName, Device: sensor.Device, Mode: currentAlarmMode})
+		s.triggerSOS(ctx, sensorLog, sensorName, sensor.Device, currentAlarmMode)
+	case config.ActionArmHome:
+		s.setActionMode(sensorLog, sensorName, s.config.Actions.ArmHomeMode)
+	case config.ActionDisarm:
+		if !s.confirms.confirm(sensorName, time.Now(), s.config.Actions.ConfirmWindow) {
+			confirmMessage := s.message(notifier.MessageActionConfirm, notifier.MessageData{SensorID: sensorName, Device: sensor.Device, Mode: s.config.Actions.DisarmMode, Duration: shortDuration(s.config.Actions.ConfirmWindow)})
+			sensorLog.Info(confirmMessage)
+			s.send(notifier.Event{Type: notifier.EventAction, Message: confirmMessage, Priority: normalPriority, Sensor: sensorName, Device: sensor.Device, Mode: currentAlarmMode})
+			return
+		}
+		s.setActionMode(sensorLog, sensorName, s.config.Actions.DisarmMode)
+	case config.ActionDuress:
+		// Duress is silent, alarm status is not changed and only a notification is sent
+		duressMessage := s.message(notifier.MessageDuress, notifier.MessageData{SensorID: sensorName, Device: sensor.Device, Mode: currentAlarmMode})
+		sensorLog.Warn(duressMessage)
+		s.send(notifier.Event{Type: notifier.EventDuress, Message: duressMessage, Priority: criticalPriority, Sensor: sensorName, Device: sensor.Device, Mode: currentAlarmMode})
+	}
+}
+
+// setActionMode sets sensor device alarm mode, failures are notified with high priority
+func (s service) setActionMode(sensorLog *slog.Logger, sensorName string, mode string) {
+	sensor := s.config.Sensors[sensorName]
+	if setErr := s.alarm.SetMode(sensor.Device, mode); setErr != nil {
+		failedMessage := s.message(notifier.MessageActionFailed, notifier.MessageData{SensorID: sensorName, Device: sensor.Device, Mode: mode, Error: setErr.Error()})
+		sensorLog.Error(failedMessage)
+		s.send(notifier.Event{Type: notifier.EventAction, Message: failedMessage, Priority: highPriority, Sensor: sensorName, Device: sensor.Device, Mode: mode})
+		return
+	}
+	modeMessage := s.message(notifier.MessageActionSetMode, notifier.MessageData{SensorID: sensorName, Device: sensor.Device, Mode: mode})
+	sensorLog.Info(modeMessage)
+	s.send(notifier.Event{Type: notifier.EventAction, Message: modeMessage, Priority: normalPriority, Sensor: sensorName, Device: sensor.Device, Mode: mode})
+}
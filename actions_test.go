@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+func newActionsTestService(t *testing.T, sent *[]notifier.Event) (service, *bytes.Buffer) {
+	actionsService := newBypassTestService(t, storage.NewMemoryStorage(), sent)
+	actionsService.config.Sensors["button1"] = &config.Sensor{Name: "button1", FriendlyName: "Bedside button", Type: "action", Device: "1", Zone: config.ZoneIntrusion, Actions: map[string]string{"single": config.ActionArmHome, "double": config.ActionDisarm, "hold": config.ActionPanic, "triple": config.ActionDuress}, SensorTriggers: map[string]bool{}}
+	router, _ := buildTopicRouter(actionsService.config)
+	actionsService.router = router
+	var out bytes.Buffer
+	actionsService.alarm = &simulatedController{out: &out, mode: "disarmed"}
+	actionsService.confirms = newActionConfirmations()
+	return actionsService, &out
+}
+
+func TestActionConfirmations(t *testing.T) {
+	confirmations := newActionConfirmations()
+	now := time.Now()
+	if confirmations.confirm("button1", now, 5*time.Second) {
+		t.Errorf("First request should not be confirmed.")
+	}
+	if !confirmations.confirm("button1", now.Add(3*time.Second), 5*time.Second) {
+		t.Errorf("Request repeated within window should be confirmed.")
+	}
+	if confirmations.confirm("button1", now.Add(4*time.Second), 5*time.Second) {
+		t.Errorf("Confirmed requests should not be reused.")
+	}
+	if confirmations.confirm("button1", now.Add(10*time.Second), 5*time.Second) {
+		t.Errorf("Request repeated after window should not be confirmed.")
+	}
+}
+
+func TestHandleActions(t *testing.T) {
+	var sent []notifier.Event
+	actionsService, out := newActionsTestService(t, &sent)
+	ctx := context.Background()
+
+	actionsService.handleMessage(ctx, "sensor/button1", `{"action":"single"}`)
+	if !strings.Contains(out.String(), "MODE CHANGE: device 1 set to home_armed") {
+		t.Errorf("Single action should arm home. Output: %s", out.String())
+	}
+
+	out.Reset()
+	sent = nil
+	actionsService.handleMessage(ctx, "sensor/button1", `{"action":"double"}`)
+	if out.Len() != 0 || len(sent) != 1 || sent[0].Message != "Press Bedside button again within 10s to set alarm status to disarmed." {
+		t.Errorf("First disarm action should ask for confirmation. Returned: %v, %s.", sent, out.String())
+	}
+	actionsService.handleMessage(ctx, "sensor/button1", `{"action":"double"}`)
+	if !strings.Contains(out.String(), "MODE CHANGE: device 1 set to disarmed") {
+		t.Errorf("Repeated disarm action should disarm. Output: %s", out.String())
+	}
+
+	out.Reset()
+	sent = nil
+	actionsService.handleMessage(ctx, "sensor/button1", `{"action":"triple"}`)
+	if out.Len() != 0 || len(sent) != 1 || sent[0].Type != notifier.EventDuress || sent[0].Priority != criticalPriority {
+		t.Errorf("Duress should only be notified with critical priority. Returned: %v, %s.", sent, out.String())
+	}
+
+	out.Reset()
+	sent = nil
+	actionsService.handleMessage(ctx, "sensor/button1", `{"action":"hold"}`)
+	if !strings.Contains(out.String(), "SOS CALL: device 1") || len(sent) != 1 || sent[0].Priority != highPriority {
+		t.Errorf("Panic should trigger SOS while alarm is disarmed. Returned: %v, %s.", sent, out.String())
+	}
+
+	out.Reset()
+	sent = nil
+	actionsService.handleMessage(ctx, "sensor/button1", `{"action":"release"}`)
+	if out.Len() != 0 || len(sent) != 0 {
+		t.Errorf("Unmapped actions should be ignored. Returned: %v, %s.", sent, out.String())
+	}
+	if _, stored, _ := actionsService.storage.GetSensorStatus(ctx, "button1"); stored {
+		t.Errorf("Actions should not be stored as sensor status.")
+	}
+}
+
+func TestActionFieldOnContactSensor(t *testing.T) {
+	var sent []notifier.Event
+	actionsService, out := newActionsTestService(t, &sent)
+	ctx := context.Background()
+
+	actionsService.handleMessage(ctx, "sensor/door1", `{"action":"single","contact":false}`)
+	sensorStatus, stored, _ := actionsService.storage.GetSensorStatus(ctx, "door1")
+	if !stored || !sensorStatus.Activated {
+		t.Errorf("Contact value should be stored when payload carries an action. Returned: %+v, %t.", sensorStatus, stored)
+	}
+	if strings.Contains(out.String(), "MODE CHANGE") {
+		t.Errorf("Actions of contact sensors should be ignored. Output: %s", out.String())
+	}
+}
@@ -0,0 +1,78 @@
+package alarmmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	apiwatcher "github.com/a-castellano/AlarmStatusWatcher/apiwatcher"
+)
+
+const SOSMode string = "SOS"
+
+// Controller reads and changes alarm devices mode
+type Controller interface {
+	CurrentMode(deviceID string) (string, error)
+	SetMode(deviceID string, mode string) error
+}
+
+type APIController struct {
+	Host      string
+	Port      int
+	Watcher   apiwatcher.APIWatcher
+	Requester apiwatcher.Requester
+}
+
+func NewAPIController(host string, port int, client http.Client) APIController {
+	return APIController{Host: host, Port: port, Watcher: apiwatcher.APIWatcher{Host: host, Port: port}, Requester: apiwatcher.Requester{Client: client}}
+}
+
+func (controller APIController) CurrentMode(deviceID string) (string, error) {
+	apiInfo, apiInfoErr := controller.Watcher.ShowInfo(controller.Requester)
+	if apiInfoErr != nil {
+		return "", apiInfoErr
+	}
+	deviceInfo, deviceFound := apiInfo.DevicesInfo[deviceID]
+	if !deviceFound {
+		return "", errors.New("Device " + deviceID + " is not managed by alarmManager.")
+	}
+	return deviceInfo.Mode, nil
+}
+
+func (controller APIController) SetMode(deviceID string, mode string) error {
+	jsonStr, _ := json.Marshal(map[string]string{"mode": mode})
+	apiURL := fmt.Sprintf("http://%s:%d/devices/status/%s", controller.Host, controller.Port, deviceID)
+	req, requestErr := http.NewRequest("PUT", apiURL, bytes.NewBuffer(jsonStr))
+	if requestErr != nil {
+		return requestErr
+	}
+	req.Header.Set("Content-Type", "application/json")
+	response, responseErr := controller.Requester.CallAlarmManager(req)
+	if responseErr != nil {
+		return responseErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("alarmManager returned status %d setting device %s mode to %s", response.StatusCode, deviceID, mode)
+	}
+	return nil
+}
+
+// DryRunController reads modes from wrapped controller but never changes them, mode changes are reported to observer
+type DryRunController struct {
+	Controller Controller
+	Observer   func(deviceID string, mode string)
+}
+
+func (controller DryRunController) CurrentMode(deviceID string) (string, error) {
+	return controller.Controller.CurrentMode(deviceID)
+}
+
+func (controller DryRunController) SetMode(deviceID string, mode string) error {
+	if controller.Observer != nil {
+		controller.Observer(deviceID, mode)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package alarmmanager
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func newTestController(handler http.HandlerFunc) (APIController, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	host, portString, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portString)
+	return NewAPIController(host, port, http.Client{}), server
+}
+
+func TestCurrentMode(t *testing.T) {
+	controller, server := newTestController(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/devices":
+			w.Write([]byte(`{"success":true,"data":{"1":"Home Alarm"}}`))
+		case "/devices/status/1":
+			w.Write([]byte(`{"success":true,"msg":"","mode":"armed","firing":false,"online":true}`))
+		}
+	})
+	defer server.Close()
+
+	mode, err := controller.CurrentMode("1")
+	if err != nil {
+		t.Fatalf("CurrentMode should not fail, error was %s", err.Error())
+	}
+	if mode != "armed" {
+		t.Errorf("Mode should be armed. Returned: %s.", mode)
+	}
+	if _, unknownErr := controller.CurrentMode("2"); unknownErr == nil {
+		t.Errorf("CurrentMode with unknown device should fail.")
+	}
+}
+
+func TestSetMode(t *testing.T) {
+	var receivedBody string
+	controller, server := newTestController(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/devices/status/1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		receivedBody = string(body)
+	})
+	defer server.Close()
+
+	if err := controller.SetMode("1", SOSMode); err != nil {
+		t.Fatalf("SetMode should not fail, error was %s", err.Error())
+	}
+	if receivedBody != `{"mode":"SOS"}` {
+		t.Errorf("Unexpected body %s.", receivedBody)
+	}
+	if err := controller.SetMode("2", SOSMode); err == nil {
+		t.Errorf("SetMode should fail when alarmManager returns error status.")
+	}
+}
+
+type recordingController struct {
+	modes map[string]string
+}
+
+func (controller *recordingController) CurrentMode(deviceID string) (string, error) {
+	return controller.modes[deviceID], nil
+}
+
+func (controller *recordingController) SetMode(deviceID string, mode string) error {
+	controller.modes[deviceID] = mode
+	return nil
+}
+
+func TestDryRunController(t *testing.T) {
+	wrapped := &recordingController{modes: map[string]string{"1": "armed"}}
+	var observedMode string
+	controller := DryRunController{Controller: wrapped, Observer: func(deviceID string, mode string) {
+		observedMode = mode
+	}}
+
+	if mode, _ := controller.CurrentMode("1"); mode != "armed" {
+		t.Errorf("DryRunController should read wrapped controller mode. Returned: %s.", mode)
+	}
+	if err := controller.SetMode("1", SOSMode); err != nil {
+		t.Errorf("DryRunController SetMode should not fail, error was %s", err.Error())
+	}
+	if wrapped.modes["1"] != "armed" {
+		t.Errorf("DryRunController should not change wrapped controller mode.")
+	}
+	if observedMode != SOSMode {
+		t.Errorf("DryRunController should report SOS mode to observer. Returned: %s.", observedMode)
+	}
+}
@@ -0,0 +1,156 @@
+package alarmmanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Fail-safe policies applied when alarmManager is unreachable
+const (
+	FailSafeLastKnown string = "last_known"
+	FailSafeArmed     string = "armed"
+	FailSafeNone      string = "none"
+)
+
+// ModeStorage keeps last known mode of each device
+type ModeStorage interface {
+	StoreAlarmMode(ctx context.Context, deviceID string, mode string) error
+	GetAlarmMode(ctx context.Context, deviceID string) (string, bool, error)
+}
+
+// Tracker polls devices mode and answers mode requests from its cache
+type Tracker struct {
+	controller   Controller
+	storage      ModeStorage
+	pollInterval time.Duration
+	failSafe     string
+	failSafeMode string
+	devices      []string
+	onChange     func(deviceID string, previousMode string, mode string)
+	mutex        sync.Mutex
+	modes        map[string]string
+	// unreachable devices failed last poll, fail-safe policy only applies to them
+	unreachable map[string]bool
+}
+
+func NewTracker(controller Controller, storage ModeStorage, devices []string, pollInterval time.Duration, failSafe string, failSafeMode string) *Tracker {
+	return &Tracker{controller: controller, storage: storage, devices: devices, pollInterval: pollInterval, failSafe: failSafe, failSafeMode: failSafeMode, modes: make(map[string]string), unreachable: make(map[string]bool)}
+}
+
+// OnChange registers a callback called when a polled device mode differs from the known one
+func (tracker *Tracker) OnChange(callback func(deviceID string, previousMode string, mode string)) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.onChange = callback
+}
+
+// Poll reads every tracked device mode, cache and storage are updated
+func (tracker *Tracker) Poll(ctx context.Context) error {
+	var pollErr error
+	for _, deviceID := range tracker.devices {
+		if deviceErr := tracker.pollDevice(ctx, deviceID); deviceErr != nil {
+			pollErr = deviceErr
+		}
+	}
+	return pollErr
+}
+
+// pollDevice reads device mode, onChange is called when it differs from the known one
+func (tracker *Tracker) pollDevice(ctx context.Context, deviceID string) error {
+	var pollErr error
+	mode, modeErr := tracker.controller.CurrentMode(deviceID)
+	tracker.mutex.Lock()
+	tracker.unreachable[deviceID] = modeErr != nil
+	tracker.mutex.Unlock()
+	if modeErr != nil {
+		return modeErr
+	}
+	tracker.mutex.Lock()
+	previousMode, known := tracker.modes[deviceID]
+	tracker.modes[deviceID] = mode
+	onChange := tracker.onChange
+	tracker.mutex.Unlock()
+
+	if !known {
+		previousMode, known, _ = tracker.storage.GetAlarmMode(ctx, deviceID)
+	}
+	if !known || previousMode != mode {
+		if storeErr := tracker.storage.StoreAlarmMode(ctx, deviceID, mode); storeErr != nil {
+			pollErr = storeErr
+		}
+	}
+	if known && previousMode != mode && onChange != nil {
+		onChange(deviceID, previousMode, mode)
+	}
+	return pollErr
+}
+
+// Run polls devices until context is done, poll errors are sent to onError
+func (tracker *Tracker) Run(ctx context.Context, onError func(error)) {
+	ticker := time.NewTicker(tracker.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if pollErr := tracker.Poll(ctx); pollErr != nil && onError != nil {
+			onError(pollErr)
+		}
+	}
+}
+
+func (tracker *Tracker) CurrentMode(deviceID string) (string, error) {
+	tracker.mutex.Lock()
+	mode, cached := tracker.modes[deviceID]
+	reachable := !tracker.unreachable[deviceID]
+	tracker.mutex.Unlock()
+
+	if !tracker.isTracked(deviceID) {
+		return tracker.controller.CurrentMode(deviceID)
+	}
+	if reachable && cached {
+		return mode, nil
+	}
+
+	switch tracker.failSafe {
+	case FailSafeArmed:
+		return tracker.failSafeMode, nil
+	case FailSafeLastKnown:
+		if cached {
+			return mode, nil
+		}
+		storedMode, found, storageErr := tracker.storage.GetAlarmMode(context.Background(), deviceID)
+		if storageErr != nil {
+			return "", storageErr
+		}
+		if found {
+			return storedMode, nil
+		}
+		return "", errors.New("alarmManager is unreachable and device " + deviceID + " mode is unknown.")
+	}
+	return "", errors.New("alarmManager is unreachable, device " + deviceID + " mode is unknown.")
+}
+
+// SetMode changes mode through wrapped controller, tracked devices are polled right away so changes are not delayed until next poll
+func (tracker *Tracker) SetMode(deviceID string, mode string) error {
+	if setErr := tracker.controller.SetMode(deviceID, mode); setErr != nil {
+		return setErr
+	}
+	if tracker.isTracked(deviceID) {
+		tracker.pollDevice(context.Background(), deviceID)
+	}
+	return nil
+}
+
+func (tracker *Tracker) isTracked(deviceID string) bool {
+	for _, trackedDevice := range tracker.devices {
+		if trackedDevice == deviceID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package alarmmanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	storage "github.com/a-castellano/AlarmSensors/storage"
+)
+
+type unreliableController struct {
+	mode           string
+	unreachable    bool
+	failingDevices map[string]bool
+	calls          int
+}
+
+func (controller *unreliableController) CurrentMode(deviceID string) (string, error) {
+	controller.calls++
+	if controller.unreachable || controller.failingDevices[deviceID] {
+		return "", errors.New("connection refused")
+	}
+	return controller.mode, nil
+}
+
+func (controller *unreliableController) SetMode(deviceID string, mode string) error {
+	controller.mode = mode
+	return nil
+}
+
+func TestTrackerCachesMode(t *testing.T) {
+	controller := &unreliableController{mode: "armed"}
+	tracker := NewTracker(controller, storage.NewMemoryStorage(), []string{"1"}, 0, FailSafeNone, "")
+	var ctx = context.TODO()
+
+	if err := tracker.Poll(ctx); err != nil {
+		t.Fatalf("Poll should not fail, error was %s", err.Error())
+	}
+	mode, err := tracker.CurrentMode("1")
+	if err != nil || mode != "armed" {
+		t.Errorf("CurrentMode should return cached armed mode. Returned: %s, %v.", mode, err)
+	}
+	if controller.calls != 1 {
+		t.Errorf("CurrentMode should not call alarmManager. Calls: %d.", controller.calls)
+	}
+}
+
+func TestTrackerOnChange(t *testing.T) {
+	controller := &unreliableController{mode: "disarmed"}
+	tracker := NewTracker(controller, storage.NewMemoryStorage(), []string{"1"}, 0, FailSafeNone, "")
+	var ctx = context.TODO()
+	var changes []string
+	tracker.OnChange(func(deviceID string, previousMode string, mode string) {
+		changes = append(changes, previousMode+">"+mode)
+	})
+
+	tracker.Poll(ctx)
+	controller.mode = "armed"
+	tracker.Poll(ctx)
+	tracker.Poll(ctx)
+
+	if len(changes) != 1 || changes[0] != "disarmed>armed" {
+		t.Errorf("There should be one disarmed>armed change. Returned: %v.", changes)
+	}
+}
+
+func TestTrackerSetModeNotifiesChange(t *testing.T) {
+	controller := &unreliableController{mode: "disarmed"}
+	tracker := NewTracker(controller, storage.NewMemoryStorage(), []string{"1"}, 0, FailSafeNone, "")
+	var changes []string
+	tracker.OnChange(func(deviceID string, previousMode string, mode string) {
+		changes = append(changes, previousMode+">"+mode)
+	})
+
+	tracker.Poll(context.TODO())
+	if err := tracker.SetMode("1", "armed"); err != nil {
+		t.Fatalf("SetMode should not fail, error was %s", err.Error())
+	}
+	if len(changes) != 1 || changes[0] != "disarmed>armed" {
+		t.Errorf("SetMode should notify change without waiting for next poll. Returned: %v.", changes)
+	}
+	if mode, _ := tracker.CurrentMode("1"); mode != "armed" {
+		t.Errorf("SetMode should update cached mode. Returned: %s.", mode)
+	}
+}
+
+func TestTrackerFailSafePolicies(t *testing.T) {
+	var ctx = context.TODO()
+	modeStorage := storage.NewMemoryStorage()
+	modeStorage.StoreAlarmMode(ctx, "1", "home_armed")
+
+	controller := &unreliableController{unreachable: true}
+
+	lastKnownTracker := NewTracker(controller, modeStorage, []string{"1"}, 0, FailSafeLastKnown, "")
+	lastKnownTracker.Poll(ctx)
+	if mode, err := lastKnownTracker.CurrentMode("1"); err != nil || mode != "home_armed" {
+		t.Errorf("last_known policy should return stored mode. Returned: %s, %v.", mode, err)
+	}
+
+	armedTracker := NewTracker(controller, modeStorage, []string{"1"}, 0, FailSafeArmed, "armed")
+	armedTracker.Poll(ctx)
+	if mode, err := armedTracker.CurrentMode("1"); err != nil || mode != "armed" {
+		t.Errorf("armed policy should return fail-safe mode. Returned: %s, %v.", mode, err)
+	}
+
+	noneTracker := NewTracker(controller, modeStorage, []string{"1"}, 0, FailSafeNone, "")
+	noneTracker.Poll(ctx)
+	if _, err := noneTracker.CurrentMode("1"); err == nil {
+		t.Errorf("none policy should fail when alarmManager is unreachable.")
+	}
+}
+
+func TestTrackerReachabilityPerDevice(t *testing.T) {
+	var ctx = context.TODO()
+	modeStorage := storage.NewMemoryStorage()
+	controller := &unreliableController{mode: "disarmed", failingDevices: map[string]bool{"2": true}}
+
+	tracker := NewTracker(controller, modeStorage, []string{"1", "2"}, 0, FailSafeArmed, "armed")
+	if err := tracker.Poll(ctx); err == nil {
+		t.Errorf("Poll should fail when a device cannot be read.")
+	}
+	if mode, err := tracker.CurrentMode("1"); err != nil || mode != "disarmed" {
+		t.Errorf("Healthy device should return polled mode. Returned: %s, %v.", mode, err)
+	}
+	if mode, err := tracker.CurrentMode("2"); err != nil || mode != "armed" {
+		t.Errorf("Failing device should return fail-safe mode. Returned: %s, %v.", mode, err)
+	}
+
+	controller.failingDevices = nil
+	tracker.Poll(ctx)
+	if mode, err := tracker.CurrentMode("2"); err != nil || mode != "disarmed" {
+		t.Errorf("Device should return polled mode once it is reachable again. Returned: %s, %v.", mode, err)
+	}
+}
@@ -5,53 +5,171 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	storage "github.com/a-castellano/AlarmSensors/storage"
 )
 
-func RetriveChildTopic(wildcardTopic string, topic string) string {
-	return strings.TrimPrefix(wildcardTopic, topic)
+// Sensor states returned by ApplySensorValue
+const (
+	StateOpened string = "opened"
+	StateClosed string = "closed"
+	StateMotion string = "motion"
+	StateClear  string = "clear"
+	// Life-safety states
+	StateLeak                string = "leak"
+	StateDry                 string = "dry"
+	StateSmoke               string = "smoke"
+	StateSmokeClear          string = "smoke_clear"
+	StateCarbonMonoxide      string = "carbon_monoxide"
+	StateCarbonMonoxideClear string = "carbon_monoxide_clear"
+)
+
+// Sensor value kinds, they are payload keys
+const (
+	KindContact   string = "contact"
+	KindOccupancy string = "occupancy"
+	// Life-safety kinds are activated when their value is true
+	KindWaterLeak      string = "water_leak"
+	KindSmoke          string = "smoke"
+	KindCarbonMonoxide string = "carbon_monoxide"
+	// Action values are button events such as single, double or hold, they are never stored
+	KindAction string = "action"
+)
+
+// lifeSafetyKinds are looked for in this order on untyped sensors, active values take precedence
+var lifeSafetyKinds = []string{KindWaterLeak, KindSmoke, KindCarbonMonoxide}
+
+// sensorTypeKinds maps configured sensor types to the only payload key they are decoded from
+var sensorTypeKinds = map[string]string{
+	"contact":         KindContact,
+	"motion":          KindOccupancy,
+	"water_leak":      KindWaterLeak,
+	"smoke":           KindSmoke,
+	"carbon_monoxide": KindCarbonMonoxide,
 }
 
-func CheckSensorTriggered(ctx context.Context, sensorName string, payload string, storageInstance storage.Storage) (bool, string, bool, error) {
+// lifeSafetyStates maps life-safety kinds to their activated and clear states
+var lifeSafetyStates = map[string][2]string{
+	KindWaterLeak:      {StateLeak, StateDry},
+	KindSmoke:          {StateSmoke, StateSmokeClear},
+	KindCarbonMonoxide: {StateCarbonMonoxide, StateCarbonMonoxideClear},
+}
 
-	var activated bool = false
-	var storageChanged bool = false
-	var message string
+// SensorValue is a decoded sensor payload value, Action is only set on action values
+type SensorValue struct {
+	Kind   string
+	Value  bool
+	Action string
+}
 
+// DecodeSensorValue reads action, contact, occupancy or life-safety value from payload, found is false when payload has none of them
+// Typed sensors are decoded from their own key, actions are only read on action sensors, untyped sensors report any active life-safety value before occupancy or contact
+func DecodeSensorValue(payload string, sensorType string) (SensorValue, bool, error) {
+	var sensorValue SensorValue
 	var sensorData map[string]interface{}
 
-	err := json.Unmarshal([]byte(payload), &sensorData)
-	if err != nil {
-		return storageChanged, message, activated, err
-	}
-	// Check if sensor type is conectat one
-	if _, isContactSensor := sensorData["contact"]; isContactSensor {
-		sensorValue := sensorData["contact"].(bool)
-		changed, _ := storageInstance.UpdateAndNotify(ctx, sensorName, sensorValue)
-		storageChanged = changed
-		if changed == true {
-			if sensorValue == false {
-				message = fmt.Sprintf("Contact sensor '%s' has been opened.", sensorName)
-				activated = true
-			} else {
-				message = fmt.Sprintf("Contact sensor '%s' has been closed.", sensorName)
-			}
+	if err := json.Unmarshal([]byte(payload), &sensorData); err != nil {
+		return sensorValue, false, err
+	}
+	// Only action sensors read actions, other sensors may publish them along with their values
+	if sensorType == KindAction {
+		return decodeAction(sensorData)
+	}
+	if kind, typed := sensorTypeKinds[sensorType]; typed {
+		return decodeKind(sensorData, kind)
+	}
+	var inactiveValue SensorValue
+	var inactiveFound bool
+	for _, kind := range lifeSafetyKinds {
+		value, found, err := decodeKind(sensorData, kind)
+		if err != nil {
+			return sensorValue, false, err
+		}
+		if found && value.Value == true {
+			return value, true, nil
+		}
+		if found && !inactiveFound {
+			inactiveValue, inactiveFound = value, true
 		}
 	}
-	// Check is sensor type is motion
-	if _, isMotionSensor := sensorData["occupancy"]; isMotionSensor {
-		sensorValue := sensorData["occupancy"].(bool)
-		changed, _ := storageInstance.UpdateAndNotify(ctx, sensorName, sensorValue)
-		storageChanged = changed
-		if changed == true {
-			if sensorValue == true {
-				message = fmt.Sprintf("Motion sensor '%s' has been triggered.", sensorName)
-				activated = true
-			} else {
-				message = fmt.Sprintf("Motion sensor '%s' has been triggered.", sensorName)
-			}
+	for _, kind := range []string{KindOccupancy, KindContact} {
+		if value, found, err := decodeKind(sensorData, kind); err != nil || found {
+			return value, found, err
+		}
+	}
+	return inactiveValue, inactiveFound, nil
+}
+
+// decodeAction reads action value, empty and null actions are sent by some devices after each action
+func decodeAction(sensorData map[string]interface{}) (SensorValue, bool, error) {
+	var sensorValue SensorValue
+
+	rawAction := sensorData[KindAction]
+	if rawAction == nil {
+		return sensorValue, false, nil
+	}
+	action, isString := rawAction.(string)
+	if !isString {
+		return sensorValue, false, fmt.Errorf("sensor %s value must be a string", KindAction)
+	}
+	if action == "" {
+		return sensorValue, false, nil
+	}
+	return SensorValue{Kind: KindAction, Action: strings.ToLower(action)}, true, nil
+}
+
+// decodeKind reads the boolean value stored under kind key
+func decodeKind(sensorData map[string]interface{}, kind string) (SensorValue, bool, error) {
+	var sensorValue SensorValue
+
+	rawValue, hasKind := sensorData[kind]
+	if !hasKind {
+		return sensorValue, false, nil
+	}
+	value, isBool := rawValue.(bool)
+	if !isBool {
+		return sensorValue, false, fmt.Errorf("sensor %s value must be a boolean", kind)
+	}
+	return SensorValue{Kind: kind, Value: value}, true, nil
+}
+
+// ApplySensorValue stores sensor value, new state is returned when it has changed
+func ApplySensorValue(ctx context.Context, sensorName string, sensorValue SensorValue, storageInstance storage.SensorStorage) (bool, string, bool, error) {
+	var state string
+	var activated bool
+
+	changed, err := storageInstance.UpdateAndNotify(ctx, sensorName, sensorValue.Value)
+	if err != nil || !changed {
+		return false, state, activated, err
+	}
+	switch sensorValue.Kind {
+	case KindContact:
+		// Contact sensors are activated when they open
+		if sensorValue.Value == false {
+			state = StateOpened
+			activated = true
+		} else {
+			state = StateClosed
+		}
+	case KindOccupancy:
+		if sensorValue.Value == true {
+			state = StateMotion
+			activated = true
+		} else {
+			state = StateClear
 		}
+	default:
+		states := lifeSafetyStates[sensorValue.Kind]
+		if sensorValue.Value == true {
+			state = states[0]
+			activated = true
+		} else {
+			state = states[1]
+		}
+	}
+	if activatedErr := storageInstance.SetActivated(ctx, sensorName, sensorValue.Kind, activated, time.Now()); activatedErr != nil {
+		return changed, state, activated, activatedErr
 	}
-	return storageChanged, message, activated, nil
+	return changed, state, activated, nil
 }
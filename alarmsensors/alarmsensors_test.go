@@ -1 +1,90 @@
 package alarmsensors
+
+import (
+	"context"
+	"testing"
+
+	storage "github.com/a-castellano/AlarmSensors/storage"
+)
+
+func TestDecodeSensorValue(t *testing.T) {
+	sensorValue, found, err := DecodeSensorValue(`{"contact":false,"battery":100}`, "")
+	if err != nil || !found || sensorValue != (SensorValue{Kind: KindContact, Value: false}) {
+		t.Errorf("Contact value should be decoded. Returned: %+v, %t, %v.", sensorValue, found, err)
+	}
+	sensorValue, found, err = DecodeSensorValue(`{"smoke":true,"battery_low":false}`, "")
+	if err != nil || !found || sensorValue != (SensorValue{Kind: KindSmoke, Value: true}) {
+		t.Errorf("Smoke value should be decoded. Returned: %+v, %t, %v.", sensorValue, found, err)
+	}
+	sensorValue, found, err = DecodeSensorValue(`{"action":"Single","linkquality":120}`, "action")
+	if err != nil || !found || sensorValue != (SensorValue{Kind: KindAction, Action: "single"}) {
+		t.Errorf("Action value should be decoded. Returned: %+v, %t, %v.", sensorValue, found, err)
+	}
+	sensorValue, found, err = DecodeSensorValue(`{"smoke":false,"carbon_monoxide":true}`, "")
+	if err != nil || !found || sensorValue != (SensorValue{Kind: KindCarbonMonoxide, Value: true}) {
+		t.Errorf("Active life-safety value should be decoded on untyped sensors. Returned: %+v, %t, %v.", sensorValue, found, err)
+	}
+	sensorValue, found, err = DecodeSensorValue(`{"smoke":false,"carbon_monoxide":true}`, "smoke")
+	if err != nil || !found || sensorValue != (SensorValue{Kind: KindSmoke, Value: false}) {
+		t.Errorf("Smoke sensors should only decode smoke value. Returned: %+v, %t, %v.", sensorValue, found, err)
+	}
+	sensorValue, found, err = DecodeSensorValue(`{"smoke":false,"contact":true}`, "")
+	if err != nil || !found || sensorValue != (SensorValue{Kind: KindContact, Value: true}) {
+		t.Errorf("Inactive life-safety value should not hide contact value. Returned: %+v, %t, %v.", sensorValue, found, err)
+	}
+	if _, found, err := DecodeSensorValue(`{"contact":true}`, "motion"); err != nil || found {
+		t.Errorf("Motion sensors should not decode contact value. Returned: %t, %v.", found, err)
+	}
+	sensorValue, found, err = DecodeSensorValue(`{"action":null,"contact":false}`, "contact")
+	if err != nil || !found || sensorValue != (SensorValue{Kind: KindContact, Value: false}) {
+		t.Errorf("Contact value should be decoded when payload carries an action. Returned: %+v, %t, %v.", sensorValue, found, err)
+	}
+	sensorValue, found, err = DecodeSensorValue(`{"action":"single","occupancy":true}`, "")
+	if err != nil || !found || sensorValue != (SensorValue{Kind: KindOccupancy, Value: true}) {
+		t.Errorf("Untyped sensors should not decode actions. Returned: %+v, %t, %v.", sensorValue, found, err)
+	}
+	if _, found, err := DecodeSensorValue(`{"action":null}`, "action"); err != nil || found {
+		t.Errorf("Null action should not be found. Returned: %t, %v.", found, err)
+	}
+	if _, found, err := DecodeSensorValue(`{"action":""}`, "action"); err != nil || found {
+		t.Errorf("Empty action should not be found. Returned: %t, %v.", found, err)
+	}
+	if _, found, err := DecodeSensorValue(`{"battery":100}`, ""); err != nil || found {
+		t.Errorf("Payload without sensor value should not be found. Returned: %t, %v.", found, err)
+	}
+	if _, _, err := DecodeSensorValue(`{"occupancy":"yes"}`, ""); err == nil {
+		t.Error("Non boolean occupancy should fail.")
+	}
+	if _, _, err := DecodeSensorValue(`{"action":1}`, "action"); err == nil {
+		t.Error("Non string action should fail.")
+	}
+	if _, _, err := DecodeSensorValue(`not json`, ""); err == nil {
+		t.Error("Invalid payload should fail.")
+	}
+}
+
+func TestApplySensorValue(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	ctx := context.Background()
+
+	changed, state, activated, _ := ApplySensorValue(ctx, "door1", SensorValue{Kind: KindContact, Value: false}, memoryStorage)
+	if !changed || state != StateOpened || !activated {
+		t.Errorf("Opened contact should activate sensor. Returned: %t, %s, %t.", changed, state, activated)
+	}
+	changed, _, _, _ = ApplySensorValue(ctx, "door1", SensorValue{Kind: KindContact, Value: false}, memoryStorage)
+	if changed {
+		t.Error("Repeated value should not change sensor state.")
+	}
+	changed, state, activated, _ = ApplySensorValue(ctx, "motion1", SensorValue{Kind: KindOccupancy, Value: true}, memoryStorage)
+	if !changed || state != StateMotion || !activated {
+		t.Errorf("Occupancy should activate sensor. Returned: %t, %s, %t.", changed, state, activated)
+	}
+	changed, state, activated, _ = ApplySensorValue(ctx, "kitchen_leak", SensorValue{Kind: KindWaterLeak, Value: true}, memoryStorage)
+	if !changed || state != StateLeak || !activated {
+		t.Errorf("Water leak should activate sensor. Returned: %t, %s, %t.", changed, state, activated)
+	}
+	changed, state, activated, _ = ApplySensorValue(ctx, "kitchen_leak", SensorValue{Kind: KindWaterLeak, Value: false}, memoryStorage)
+	if !changed || state != StateDry || activated {
+		t.Errorf("Dry sensor should not be activated. Returned: %t, %s, %t.", changed, state, activated)
+	}
+}
@@ -0,0 +1,30 @@
+package alarmsensors
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ParseAvailability reads Zigbee2MQTT availability and bridge state payloads, both legacy plain text and JSON ones
+func ParseAvailability(payload string) (bool, error) {
+	state := strings.TrimSpace(payload)
+	if strings.HasPrefix(state, "{") {
+		var availabilityData map[string]interface{}
+		if err := json.Unmarshal([]byte(state), &availabilityData); err != nil {
+			return false, err
+		}
+		jsonState, isString := availabilityData["state"].(string)
+		if !isString {
+			return false, errors.New("Availability payload has no state field.")
+		}
+		state = jsonState
+	}
+	switch strings.ToLower(state) {
+	case "online":
+		return true, nil
+	case "offline":
+		return false, nil
+	}
+	return false, errors.New("Unknown availability state '" + state + "'.")
+}
@@ -0,0 +1,30 @@
+package alarmsensors
+
+import (
+	"testing"
+)
+
+func TestParseAvailability(t *testing.T) {
+	cases := map[string]bool{
+		"online":              true,
+		"offline":             false,
+		`{"state":"online"}`:  true,
+		`{"state":"offline"}`: false,
+		" Online\n":           true,
+	}
+	for payload, expectedOnline := range cases {
+		online, err := ParseAvailability(payload)
+		if err != nil {
+			t.Errorf("ParseAvailability should not fail with '%s': %s", payload, err.Error())
+		}
+		if online != expectedOnline {
+			t.Errorf("ParseAvailability with '%s' should return %t.", payload, expectedOnline)
+		}
+	}
+	invalidPayloads := []string{"", "unknown", `{"status":"online"}`, `{"state":`}
+	for _, payload := range invalidPayloads {
+		if _, err := ParseAvailability(payload); err == nil {
+			t.Errorf("ParseAvailability should fail with '%s'.", payload)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package alarmsensors
+
+import (
+	"sync"
+	"time"
+)
+
+// DebounceSettings filter sensor values before they are stored
+type DebounceSettings struct {
+	// Duration a value has to persist before it is applied, values are applied at once when it is 0
+	Duration time.Duration
+	// OccupancyCount is the number of consecutive occupancy=true messages required to apply motion
+	OccupancyCount int
+}
+
+type pendingValue struct {
+	value      SensorValue
+	generation uint64
+	timer      *time.Timer
+}
+
+// Debouncer holds sensor values until debounce settings are met, it is safe for concurrent use
+type Debouncer struct {
+	mutex      sync.Mutex
+	generation uint64
+	pending    map[string]*pendingValue
+	occupancy  map[string]int
+}
+
+func NewDebouncer() *Debouncer {
+	return &Debouncer{pending: make(map[string]*pendingValue), occupancy: make(map[string]int)}
+}
+
+// Submit passes sensor value to apply once debounce settings are met, apply may be called from a timer goroutine
+func (debouncer *Debouncer) Submit(sensorName string, sensorValue SensorValue, settings DebounceSettings, apply func(SensorValue)) {
+	debouncer.mutex.Lock()
+	if sensorValue.Kind == KindOccupancy && settings.OccupancyCount > 1 {
+		if !sensorValue.Value {
+			debouncer.occupancy[sensorName] = 0
+		} else {
+			debouncer.occupancy[sensorName]++
+			if debouncer.occupancy[sensorName] < settings.OccupancyCount {
+				debouncer.mutex.Unlock()
+				return
+			}
+		}
+	}
+
+	if settings.Duration <= 0 {
+		debouncer.mutex.Unlock()
+		apply(sensorValue)
+		return
+	}
+
+	// Persistence is measured since the value was first received
+	if pending, isPending := debouncer.pending[sensorName]; isPending {
+		if pending.value == sensorValue {
+			debouncer.mutex.Unlock()
+			return
+		}
+		pending.timer.Stop()
+	}
+	debouncer.generation++
+	pending := &pendingValue{value: sensorValue, generation: debouncer.generation}
+	debouncer.pending[sensorName] = pending
+	pending.timer = time.AfterFunc(settings.Duration, func() {
+		debouncer.mutex.Lock()
+		current, isPending := debouncer.pending[sensorName]
+		// A newer value replaced this one while timer was firing
+		if !isPending || current.generation != pending.generation {
+			debouncer.mutex.Unlock()
+			return
+		}
+		delete(debouncer.pending, sensorName)
+		debouncer.mutex.Unlock()
+		apply(pending.value)
+	})
+	debouncer.mutex.Unlock()
+}
+
+// Pending returns the number of sensor values waiting for their debounce duration
+func (debouncer *Debouncer) Pending() int {
+	debouncer.mutex.Lock()
+	defer debouncer.mutex.Unlock()
+	return len(debouncer.pending)
+}
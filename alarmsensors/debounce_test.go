@@ -0,0 +1,83 @@
+package alarmsensors
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDebouncerDuration(t *testing.T) {
+	debouncer := NewDebouncer()
+	settings := DebounceSettings{Duration: 50 * time.Millisecond}
+	applied := make(chan SensorValue, 4)
+	apply := func(sensorValue SensorValue) { applied <- sensorValue }
+
+	// Open for less than debounce duration is ignored
+	debouncer.Submit("door1", SensorValue{Kind: KindContact, Value: false}, settings, apply)
+	debouncer.Submit("door1", SensorValue{Kind: KindContact, Value: true}, settings, apply)
+	select {
+	case sensorValue := <-applied:
+		if sensorValue.Value != true {
+			t.Errorf("Only persisted closed value should be applied. Returned: %+v.", sensorValue)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Persisted value should be applied.")
+	}
+	select {
+	case sensorValue := <-applied:
+		t.Errorf("Replaced value should not be applied. Returned: %+v.", sensorValue)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if debouncer.Pending() != 0 {
+		t.Errorf("No value should be pending. Returned: %d.", debouncer.Pending())
+	}
+}
+
+func TestDebouncerOccupancyCount(t *testing.T) {
+	debouncer := NewDebouncer()
+	settings := DebounceSettings{OccupancyCount: 3}
+	var applied []SensorValue
+	apply := func(sensorValue SensorValue) { applied = append(applied, sensorValue) }
+	motion := SensorValue{Kind: KindOccupancy, Value: true}
+
+	debouncer.Submit("motion1", motion, settings, apply)
+	debouncer.Submit("motion1", motion, settings, apply)
+	debouncer.Submit("motion1", SensorValue{Kind: KindOccupancy, Value: false}, settings, apply)
+	debouncer.Submit("motion1", motion, settings, apply)
+	debouncer.Submit("motion1", motion, settings, apply)
+	if len(applied) != 1 || applied[0].Value != false {
+		t.Errorf("Occupancy should be reset by clear message. Returned: %+v.", applied)
+	}
+	debouncer.Submit("motion1", motion, settings, apply)
+	if len(applied) != 2 || applied[1] != motion {
+		t.Errorf("Third consecutive occupancy should be applied. Returned: %+v.", applied)
+	}
+}
+
+func TestDebouncerConcurrentMessages(t *testing.T) {
+	debouncer := NewDebouncer()
+	settings := DebounceSettings{Duration: 20 * time.Millisecond}
+	var mutex sync.Mutex
+	applied := 0
+	apply := func(sensorValue SensorValue) {
+		mutex.Lock()
+		applied++
+		mutex.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(value bool) {
+			defer wg.Done()
+			debouncer.Submit("door1", SensorValue{Kind: KindContact, Value: value}, settings, apply)
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	time.Sleep(100 * time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if applied != 1 {
+		t.Errorf("Only last persisted value should be applied. Applied: %d.", applied)
+	}
+}
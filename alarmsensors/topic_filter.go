@@ -0,0 +1,70 @@
+package alarmsensors
+
+import (
+	"errors"
+	"strings"
+)
+
+type TopicFilter struct {
+	Filter string
+	levels []string
+}
+
+// Sub topics published by devices next to their state topic
+var availabilitySuffix string = "availability"
+var commandSuffixes = map[string]bool{"set": true, "get": true}
+
+func ParseTopicFilter(filter string) (TopicFilter, error) {
+	var topicFilter TopicFilter
+	if filter == "" {
+		return topicFilter, errors.New("Topic filter cannot be empty.")
+	}
+	if strings.ContainsRune(filter, 0) {
+		return topicFilter, errors.New("Topic filter " + filter + " contains null character.")
+	}
+	levels := strings.Split(filter, "/")
+	for index, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || index != len(levels)-1) {
+			return topicFilter, errors.New("Topic filter " + filter + " has misplaced '#', it must be the last level.")
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return topicFilter, errors.New("Topic filter " + filter + " has misplaced '+', it must fill a whole level.")
+		}
+	}
+	topicFilter.Filter = filter
+	topicFilter.levels = levels
+	return topicFilter, nil
+}
+
+func (topicFilter TopicFilter) Match(topic string) bool {
+	_, matched := matchSegments(topicFilter.levels, strings.Split(topic, "/"))
+	return matched
+}
+
+// ValidateTopicPattern checks a router pattern, captures are handled as '+' wildcards
+func ValidateTopicPattern(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if strings.ContainsAny(segment, "{}") && !isCapture(segment) {
+			return errors.New("Topic pattern " + pattern + " has malformed capture " + segment + ".")
+		}
+	}
+	_, err := ParseTopicFilter(PatternToSubscription(pattern))
+	return err
+}
+
+// WildcardTopicPattern converts legacy wildcard_topic into a router pattern
+func WildcardTopicPattern(wildcardTopic string) (string, error) {
+	if _, err := ParseTopicFilter(wildcardTopic); err != nil {
+		return "", err
+	}
+	sensorCapture := "{" + SensorCapture + "}"
+	levels := strings.Split(wildcardTopic, "/")
+	lastLevel := levels[len(levels)-1]
+	switch lastLevel {
+	case "", "+", "#":
+		levels[len(levels)-1] = sensorCapture
+	default:
+		levels = append(levels, sensorCapture)
+	}
+	return strings.Join(levels, "/"), nil
+}
@@ -0,0 +1,60 @@
+package alarmsensors
+
+import (
+	"testing"
+)
+
+func TestParseTopicFilterErrors(t *testing.T) {
+	invalidFilters := []string{"", "sensor/++", "sensor/#/state", "sensor/a#", "sensor/+a"}
+	for _, invalidFilter := range invalidFilters {
+		if _, err := ParseTopicFilter(invalidFilter); err == nil {
+			t.Errorf("ParseTopicFilter should fail with '%s'.", invalidFilter)
+		}
+	}
+}
+
+func TestTopicFilterMatch(t *testing.T) {
+	cases := []struct {
+		filter string
+		topic  string
+		match  bool
+	}{
+		{"sensor/+", "sensor/door1", true},
+		{"sensor/+", "sensor/door1/availability", false},
+		{"sensor/#", "sensor/door1/availability", true},
+		{"sensor/#", "sensor", true},
+		{"+/+/state", "esphome/garage/state", true},
+		{"#", "$SYS/broker/uptime", false},
+		{"$SYS/#", "$SYS/broker/uptime", true},
+	}
+	for _, testCase := range cases {
+		topicFilter, err := ParseTopicFilter(testCase.filter)
+		if err != nil {
+			t.Fatalf("ParseTopicFilter should not fail with '%s': %s", testCase.filter, err.Error())
+		}
+		if topicFilter.Match(testCase.topic) != testCase.match {
+			t.Errorf("Filter '%s' matching '%s' should be %t.", testCase.filter, testCase.topic, testCase.match)
+		}
+	}
+}
+
+func TestWildcardTopicPattern(t *testing.T) {
+	cases := map[string]string{
+		"sensor/+":      "sensor/{sensor}",
+		"sensor/":       "sensor/{sensor}",
+		"sensor":        "sensor/{sensor}",
+		"zigbee2mqtt/#": "zigbee2mqtt/{sensor}",
+	}
+	for wildcardTopic, expectedPattern := range cases {
+		pattern, err := WildcardTopicPattern(wildcardTopic)
+		if err != nil {
+			t.Errorf("WildcardTopicPattern should not fail with '%s': %s", wildcardTopic, err.Error())
+		}
+		if pattern != expectedPattern {
+			t.Errorf("Pattern for '%s' should be '%s'. Returned: '%s'.", wildcardTopic, expectedPattern, pattern)
+		}
+	}
+	if _, err := WildcardTopicPattern("sensor/++"); err == nil {
+		t.Errorf("WildcardTopicPattern should fail with 'sensor/++'.")
+	}
+}
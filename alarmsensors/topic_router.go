@@ -0,0 +1,152 @@
+package alarmsensors
+
+import (
+	"strings"
+)
+
+// SensorCapture is the capture name used by patterns which take sensor name from topic
+const SensorCapture string = "sensor"
+
+type TopicKind int
+
+const (
+	TopicState TopicKind = iota
+	TopicAvailability
+	TopicCommand
+)
+
+type TopicMatch struct {
+	Sensor   string
+	Pattern  string
+	Kind     TopicKind
+	Captures map[string]string
+}
+
+type topicRoute struct {
+	pattern  string
+	segments []string
+	sensor   string
+}
+
+type TopicRouter struct {
+	routes []topicRoute
+}
+
+func NewTopicRouter() *TopicRouter {
+	return &TopicRouter{}
+}
+
+// AddRoute registers a topic pattern, if sensorName is empty sensor is taken from {sensor} capture
+func (router *TopicRouter) AddRoute(pattern string, sensorName string) error {
+	if err := ValidateTopicPattern(pattern); err != nil {
+		return err
+	}
+	newRoute := topicRoute{pattern: pattern, segments: strings.Split(pattern, "/"), sensor: sensorName}
+	if sensorName != "" {
+		// Routes with fixed sensor take precedence over capture ones
+		for index, route := range router.routes {
+			if route.sensor == "" {
+				router.routes = append(router.routes[:index], append([]topicRoute{newRoute}, router.routes[index:]...)...)
+				return nil
+			}
+		}
+	}
+	router.routes = append(router.routes, newRoute)
+	return nil
+}
+
+func (router *TopicRouter) Route(topic string) (TopicMatch, bool) {
+	if topicMatch, routed := router.routeLevels(strings.Split(topic, "/")); routed {
+		return topicMatch, true
+	}
+	// Device sub topics are routed to its parent sensor with its own kind
+	lastSeparator := strings.LastIndex(topic, "/")
+	if lastSeparator < 0 {
+		return TopicMatch{}, false
+	}
+	suffix := topic[lastSeparator+1:]
+	var kind TopicKind
+	switch {
+	case suffix == availabilitySuffix:
+		kind = TopicAvailability
+	case commandSuffixes[suffix]:
+		kind = TopicCommand
+	default:
+		return TopicMatch{}, false
+	}
+	topicMatch, routed := router.routeLevels(strings.Split(topic[:lastSeparator], "/"))
+	topicMatch.Kind = kind
+	return topicMatch, routed
+}
+
+func (router *TopicRouter) routeLevels(topicLevels []string) (TopicMatch, bool) {
+	for _, route := range router.routes {
+		captures, matched := matchSegments(route.segments, topicLevels)
+		if !matched {
+			continue
+		}
+		sensorName := route.sensor
+		if sensorName == "" {
+			sensorName = captures[SensorCapture]
+		}
+		if sensorName == "" {
+			continue
+		}
+		return TopicMatch{Sensor: sensorName, Pattern: route.pattern, Captures: captures}, true
+	}
+	return TopicMatch{}, false
+}
+
+// Subscriptions returns MQTT subscriptions needed to receive every routed topic
+func (router *TopicRouter) Subscriptions() []string {
+	var subscriptions []string
+	alreadyAdded := make(map[string]bool)
+	for _, route := range router.routes {
+		subscription := PatternToSubscription(route.pattern)
+		if _, ok := alreadyAdded[subscription]; !ok {
+			alreadyAdded[subscription] = true
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions
+}
+
+func PatternToSubscription(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	for index, segment := range segments {
+		if isCapture(segment) {
+			segments[index] = "+"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isCapture(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func matchSegments(segments []string, topicLevels []string) (map[string]string, bool) {
+	captures := make(map[string]string)
+	// Topics starting with '$' are not matched by leading wildcards
+	if len(topicLevels) > 0 && len(segments) > 0 && strings.HasPrefix(topicLevels[0], "$") {
+		if segments[0] == "+" || segments[0] == "#" || isCapture(segments[0]) {
+			return captures, false
+		}
+	}
+	for index, segment := range segments {
+		if segment == "#" {
+			return captures, true
+		}
+		if index >= len(topicLevels) {
+			return captures, false
+		}
+		switch {
+		case segment == "+":
+		case isCapture(segment):
+			captures[segment[1:len(segment)-1]] = topicLevels[index]
+		case segment != topicLevels[index]:
+			return captures, false
+		}
+	}
+	return captures, len(segments) == len(topicLevels)
+}
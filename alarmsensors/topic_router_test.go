@@ -0,0 +1,93 @@
+package alarmsensors
+
+import (
+	"testing"
+)
+
+func TestRouteLegacyPrefix(t *testing.T) {
+	router := NewTopicRouter()
+	router.AddRoute("zigbee2mqtt/{sensor}", "")
+
+	topicMatch, routed := router.Route("zigbee2mqtt/door1")
+	if !routed {
+		t.Fatalf("zigbee2mqtt/door1 should be routed.")
+	}
+	if topicMatch.Sensor != "door1" {
+		t.Errorf("Sensor should be door1. Returned: %s.", topicMatch.Sensor)
+	}
+	if _, deeperRouted := router.Route("zigbee2mqtt/door1/battery/level"); deeperRouted {
+		t.Errorf("zigbee2mqtt/door1/battery/level should not be routed.")
+	}
+}
+
+func TestRouteSubTopics(t *testing.T) {
+	router := NewTopicRouter()
+	router.AddRoute("zigbee2mqtt/{sensor}", "")
+
+	availabilityMatch, routed := router.Route("zigbee2mqtt/door1/availability")
+	if !routed {
+		t.Fatalf("zigbee2mqtt/door1/availability should be routed.")
+	}
+	if availabilityMatch.Sensor != "door1" || availabilityMatch.Kind != TopicAvailability {
+		t.Errorf("Availability topic should be routed to door1 as availability. Returned: %s, %d.", availabilityMatch.Sensor, availabilityMatch.Kind)
+	}
+	commandMatch, routed := router.Route("zigbee2mqtt/door1/set")
+	if !routed {
+		t.Fatalf("zigbee2mqtt/door1/set should be routed.")
+	}
+	if commandMatch.Kind != TopicCommand {
+		t.Errorf("Set topic should be routed as command. Returned: %d.", commandMatch.Kind)
+	}
+}
+
+func TestAddRouteInvalidPattern(t *testing.T) {
+	router := NewTopicRouter()
+	if err := router.AddRoute("zigbee2mqtt/{sensor", ""); err == nil {
+		t.Errorf("AddRoute with malformed capture should fail.")
+	}
+}
+
+func TestRouteNamedCaptures(t *testing.T) {
+	router := NewTopicRouter()
+	router.AddRoute("esphome/{node}/binary_sensor/{sensor}/state", "")
+
+	topicMatch, routed := router.Route("esphome/garage/binary_sensor/door/state")
+	if !routed {
+		t.Fatalf("esphome topic should be routed.")
+	}
+	if topicMatch.Sensor != "door" {
+		t.Errorf("Sensor should be door. Returned: %s.", topicMatch.Sensor)
+	}
+	if topicMatch.Captures["node"] != "garage" {
+		t.Errorf("node capture should be garage. Returned: %s.", topicMatch.Captures["node"])
+	}
+}
+
+func TestRouteFixedSensorPrecedence(t *testing.T) {
+	router := NewTopicRouter()
+	router.AddRoute("home/{sensor}/state", "")
+	router.AddRoute("home/+/state", "window1")
+
+	topicMatch, routed := router.Route("home/kitchen/state")
+	if !routed {
+		t.Fatalf("home/kitchen/state should be routed.")
+	}
+	if topicMatch.Sensor != "window1" {
+		t.Errorf("Fixed sensor route should win. Returned: %s.", topicMatch.Sensor)
+	}
+}
+
+func TestRouterSubscriptions(t *testing.T) {
+	router := NewTopicRouter()
+	router.AddRoute("zigbee2mqtt/{sensor}", "")
+	router.AddRoute("esphome/{node}/binary_sensor/{sensor}/state", "")
+	router.AddRoute("zigbee2mqtt/+", "door1")
+
+	subscriptions := router.Subscriptions()
+	if len(subscriptions) != 2 {
+		t.Fatalf("There should be 2 subscriptions. Returned: %v.", subscriptions)
+	}
+	if subscriptions[0] != "zigbee2mqtt/+" || subscriptions[1] != "esphome/+/binary_sensor/+/state" {
+		t.Errorf("Unexpected subscriptions: %v.", subscriptions)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	storage "github.com/a-castellano/AlarmSensors/storage"
+)
+
+// apiHandler serves HTTP API, bearer token is required when it is configured
+func (s service) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bypass", s.handleBypassList)
+	mux.HandleFunc("/bypass/", s.handleSensorBypass)
+	if s.config.API.Token == "" {
+		return mux
+	}
+	expectedAuthorization := []byte("Bearer " + s.config.API.Token)
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(request.Header.Get("Authorization")), expectedAuthorization) != 1 {
+			writeAPIError(writer, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		mux.ServeHTTP(writer, request)
+	})
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
+
+func writeAPIError(writer http.ResponseWriter, status int, message string) {
+	writeJSON(writer, status, map[string]string{"error": message})
+}
+
+// handleBypassList serves GET /bypass
+func (s service) handleBypassList(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeAPIError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	bypasses, listErr := s.storage.ListBypasses(request.Context())
+	if listErr != nil {
+		s.log.Error("Failed to read sensor bypasses.", "error", listErr)
+		writeAPIError(writer, http.StatusInternalServerError, "failed to read bypasses")
+		return
+	}
+	if bypasses == nil {
+		bypasses = []storage.Bypass{}
+	}
+	writeJSON(writer, http.StatusOK, bypasses)
+}
+
+// handleSensorBypass serves GET, PUT, POST and DELETE /bypass/<sensor>
+func (s service) handleSensorBypass(writer http.ResponseWriter, request *http.Request) {
+	sensorName := strings.TrimPrefix(request.URL.Path, "/bypass/")
+	if _, sensorIsManaged := s.config.Sensors[sensorName]; !sensorIsManaged {
+		writeAPIError(writer, http.StatusNotFound, "sensor "+sensorName+" is not declared in config")
+		return
+	}
+	ctx := request.Context()
+	switch request.Method {
+	case http.MethodGet:
+		bypass, found, bypassErr := s.storage.GetBypass(ctx, sensorName)
+		if bypassErr != nil {
+			s.log.Error("Failed to read sensor bypass.", "sensor", sensorName, "error", bypassErr)
+			writeAPIError(writer, http.StatusInternalServerError, "failed to read bypass")
+			return
+		}
+		if !found {
+			writeAPIError(writer, http.StatusNotFound, "sensor "+sensorName+" is not bypassed")
+			return
+		}
+		writeJSON(writer, http.StatusOK, bypass)
+	case http.MethodPut, http.MethodPost:
+		var bypassReq bypassRequest
+		if decodeErr := json.NewDecoder(request.Body).Decode(&bypassReq); decodeErr != nil {
+			writeAPIError(writer, http.StatusBadRequest, "invalid bypass request: "+decodeErr.Error())
+			return
+		}
+		bypassReq.Sensor = sensorName
+		bypassReq.Clear = false
+		now := time.Now()
+		if _, validationErr := newBypass(bypassReq, now); validationErr != nil {
+			writeAPIError(writer, http.StatusBadRequest, validationErr.Error())
+			return
+		}
+		bypass, bypassErr := s.applyBypass(ctx, bypassReq, now)
+		if bypassErr != nil {
+			s.log.Error("Failed to store sensor bypass.", "sensor", sensorName, "error", bypassErr)
+			writeAPIError(writer, http.StatusInternalServerError, "failed to store bypass")
+			return
+		}
+		writeJSON(writer, http.StatusOK, bypass)
+	case http.MethodDelete:
+		if _, bypassErr := s.applyBypass(ctx, bypassRequest{Sensor: sensorName, Clear: true}, time.Now()); bypassErr != nil {
+			s.log.Error("Failed to clear sensor bypass.", "sensor", sensorName, "error", bypassErr)
+			writeAPIError(writer, http.StatusInternalServerError, "failed to clear bypass")
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		writeAPIError(writer, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+)
+
+func TestAPIBypass(t *testing.T) {
+	var sent []notifier.Event
+	apiService := newBypassTestService(t, storage.NewMemoryStorage(), &sent)
+	apiService.config.API.Token = "secret"
+	server := httptest.NewServer(apiService.apiHandler())
+	defer server.Close()
+
+	apiRequest := func(method string, path string, body string, token string) *http.Response {
+		request, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("API request should not fail, error was %s", err.Error())
+		}
+		return response
+	}
+
+	if response := apiRequest(http.MethodGet, "/bypass", "", "wrong"); response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Wrong token should be rejected. Returned: %d.", response.StatusCode)
+	}
+	if response := apiRequest(http.MethodPut, "/bypass/unknown", `{"until_disarm":true}`, "secret"); response.StatusCode != http.StatusNotFound {
+		t.Errorf("Undeclared sensor should not be found. Returned: %d.", response.StatusCode)
+	}
+	if response := apiRequest(http.MethodPut, "/bypass/door1", `{"until":"yesterday"}`, "secret"); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Invalid until should be rejected. Returned: %d.", response.StatusCode)
+	}
+	if response := apiRequest(http.MethodPut, "/bypass/door1", `{"until":"30m"}`, "secret"); response.StatusCode != http.StatusOK {
+		t.Errorf("Bypass should be stored. Returned: %d.", response.StatusCode)
+	}
+
+	var bypasses []storage.Bypass
+	response := apiRequest(http.MethodGet, "/bypass", "", "secret")
+	json.NewDecoder(response.Body).Decode(&bypasses)
+	response.Body.Close()
+	if len(bypasses) != 1 || bypasses[0].Sensor != "door1" || bypasses[0].UntilDisarm {
+		t.Errorf("door1 should be bypassed. Returned: %+v.", bypasses)
+	}
+
+	if response := apiRequest(http.MethodDelete, "/bypass/door1", "", "secret"); response.StatusCode != http.StatusNoContent {
+		t.Errorf("Bypass should be cleared. Returned: %d.", response.StatusCode)
+	}
+	if response := apiRequest(http.MethodGet, "/bypass/door1", "", "secret"); response.StatusCode != http.StatusNotFound {
+		t.Errorf("Cleared bypass should not be found. Returned: %d.", response.StatusCode)
+	}
+	if len(sent) != 2 {
+		t.Errorf("Bypass set and clear should be notified. Returned: %v.", sent)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"time"
+
+	alarmsensors "github.com/a-castellano/AlarmSensors/alarmsensors"
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	"golang.org/x/net/context"
+)
+
+const silenceCheckInterval time.Duration = 30 * time.Second
+
+func availabilitySubscriptions(serviceConfig config.Config) []string {
+	if serviceConfig.Zigbee2mqtt.BaseTopic == "" {
+		return nil
+	}
+	return []string{serviceConfig.Zigbee2mqtt.BaseTopic + "/+/availability", serviceConfig.Zigbee2mqtt.BaseTopic + "/bridge/state"}
+}
+
+// alarmIsArmed returns true if any sensor triggers alarm in given mode
+func alarmIsArmed(serviceConfig config.Config, alarmMode string) bool {
+	sensorTrigger, modeDeclared := serviceConfig.SensorTriggers[alarmMode]
+	return modeDeclared && len(sensorTrigger.Sensors) > 0
+}
+
+func (s service) handleAvailability(ctx context.Context, sensorName string, message string) {
+	online, parseErr := alarmsensors.ParseAvailability(message)
+	if parseErr != nil {
+		s.log.Error("Failed to parse sensor availability.", "sensor", sensorName, "error", parseErr)
+		return
+	}
+	changed, storageErr := s.storage.UpdateAvailability(ctx, sensorName, online)
+	if storageErr != nil {
+		s.log.Error("Failed to store sensor availability.", "sensor", sensorName, "error", storageErr)
+		return
+	}
+	if changed {
+		messageKey := notifier.MessageSensorOffline
+		if online {
+			messageKey = notifier.MessageSensorOnline
+		}
+		availabilityMessage := s.message(messageKey, notifier.MessageData{SensorID: sensorName})
+		s.log.Info(availabilityMessage, "sensor", sensorName, "online", online)
+		s.send(notifier.Event{Type: notifier.EventSensorAvailability, Message: availabilityMessage, Priority: normalPriority, Sensor: sensorName, Device: s.config.Sensors[sensorName].Device})
+	}
+}
+
+func (s service) handleBridgeState(ctx context.Context, message string) {
+	online, parseErr := alarmsensors.ParseAvailability(message)
+	if parseErr != nil {
+		s.log.Error("Failed to parse Zigbee2MQTT bridge state.", "error", parseErr)
+		return
+	}
+	changed, storageErr := s.storage.UpdateBridgeAvailability(ctx, s.config.Zigbee2mqtt.BaseTopic, online)
+	if storageErr != nil {
+		s.log.Error("Failed to store Zigbee2MQTT bridge state.", "error", storageErr)
+		return
+	}
+	if !changed {
+		return
+	}
+	if online {
+		bridgeMessage := s.message(notifier.MessageBridgeOnline, notifier.MessageData{})
+		s.log.Info(bridgeMessage)
+		s.send(notifier.Event{Type: notifier.EventBridgeState, Message: bridgeMessage, Priority: normalPriority})
+		return
+	}
+	// Every device watched by sensors is checked, unknown alarm status is reported before armed ones
+	priority := normalPriority
+	deviceID := s.config.AlarmManager.DeviceId
+	var currentAlarmMode string
+	bridgeMessage := s.message(notifier.MessageBridgeOffline, notifier.MessageData{Device: deviceID})
+	for _, alarmDevice := range alarmDevices(s.config) {
+		deviceMode, modeErr := s.alarm.CurrentMode(alarmDevice)
+		if modeErr != nil {
+			// Alarm status is unknown, assume it is armed
+			s.log.Error("Failed to read alarm mode.", "device", alarmDevice, "error", modeErr)
+			priority = highPriority
+			deviceID, currentAlarmMode = alarmDevice, ""
+			bridgeMessage = s.message(notifier.MessageBridgeOfflineUnknown, notifier.MessageData{Device: alarmDevice})
+			break
+		}
+		if alarmDevice == s.config.AlarmManager.DeviceId && priority == normalPriority {
+			currentAlarmMode = deviceMode
+		}
+		if priority == normalPriority && alarmIsArmed(s.config, deviceMode) {
+			priority = highPriority
+			deviceID, currentAlarmMode = alarmDevice, deviceMode
+			bridgeMessage = s.message(notifier.MessageBridgeOfflineArmed, notifier.MessageData{Device: alarmDevice, Mode: deviceMode})
+		}
+	}
+	s.log.Error(bridgeMessage, "device", deviceID, "mode", currentAlarmMode)
+	s.send(notifier.Event{Type: notifier.EventBridgeState, Message: bridgeMessage, Priority: priority, Device: deviceID, Mode: currentAlarmMode})
+}
+
+// superviseSilence flags as offline sensors which have not reported within its silence timeout
+func (s service) superviseSilence(ctx context.Context) {
+	ticker := time.NewTicker(silenceCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		for sensorName, sensor := range s.config.Sensors {
+			if sensor.SilenceTimeout == 0 {
+				continue
+			}
+			sensorStatus, found, statusErr := s.storage.GetSensorStatus(ctx, sensorName)
+			if statusErr != nil {
+				s.log.Error("Failed to read sensor status.", "sensor", sensorName, "error", statusErr)
+				continue
+			}
+			if !found || sensorStatus.Offline {
+				continue
+			}
+			silence := now.Sub(time.Unix(sensorStatus.LastUpdated, 0))
+			if silence < sensor.SilenceTimeout {
+				continue
+			}
+			if changed, _ := s.storage.UpdateAvailability(ctx, sensorName, false); changed {
+				silenceMessage := s.message(notifier.MessageSensorSilent, notifier.MessageData{SensorID: sensorName, Device: sensor.Device, Duration: shortDuration(silence.Truncate(time.Second))})
+				s.log.Warn(silenceMessage, "sensor", sensorName)
+				s.send(notifier.Event{Type: notifier.EventSensorAvailability, Message: silenceMessage, Priority: normalPriority, Sensor: sensorName, Device: sensor.Device})
+			}
+		}
+	}
+}
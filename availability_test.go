@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+// deviceModesController answers a different mode for each device, missing devices are unreachable
+type deviceModesController struct {
+	modes map[string]string
+}
+
+func (controller deviceModesController) CurrentMode(deviceID string) (string, error) {
+	mode, found := controller.modes[deviceID]
+	if !found {
+		return "", errors.New("connection refused")
+	}
+	return mode, nil
+}
+
+func (controller deviceModesController) SetMode(deviceID string, mode string) error {
+	return nil
+}
+
+func TestBridgeOfflineChecksEveryDevice(t *testing.T) {
+	var sent []notifier.Event
+	bridgeService := newBypassTestService(t, storage.NewMemoryStorage(), &sent)
+	bridgeService.config.Zigbee2mqtt.BaseTopic = "zigbee2mqtt"
+	bridgeService.config.Sensors["window1"].Device = "2"
+	bridgeService.alarm = deviceModesController{modes: map[string]string{"1": "disarmed", "2": "armed"}}
+	ctx := context.Background()
+
+	bridgeService.handleMessage(ctx, "zigbee2mqtt/bridge/state", "offline")
+	if len(sent) != 1 || sent[0].Priority != highPriority || sent[0].Device != "2" || sent[0].Message != "Zigbee2MQTT coordinator is down while alarm status is armed, sensors are not being watched." {
+		t.Errorf("Coordinator offline should be notified with high priority when any device is armed. Returned: %v.", sent)
+	}
+
+	sent = nil
+	bridgeService.handleMessage(ctx, "zigbee2mqtt/bridge/state", "online")
+	bridgeService.alarm = deviceModesController{modes: map[string]string{"1": "disarmed"}}
+	bridgeService.handleMessage(ctx, "zigbee2mqtt/bridge/state", "offline")
+	if len(sent) != 2 || sent[1].Priority != highPriority || sent[1].Device != "2" || sent[1].Message != "Zigbee2MQTT coordinator is down and alarm status is unknown." {
+		t.Errorf("Coordinator offline should be notified with high priority when any device status is unknown. Returned: %v.", sent)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	alarmmanager "github.com/a-castellano/AlarmSensors/alarmmanager"
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+// bypassTimeLayout is used in bypass notifications
+const bypassTimeLayout string = "2006-01-02 15:04"
+
+// bypassRequest is received from HTTP API, MQTT command topic and CLI
+type bypassRequest struct {
+	Sensor      string `json:"sensor"`
+	Until       string `json:"until"`
+	UntilDisarm bool   `json:"until_disarm"`
+	Clear       bool   `json:"clear"`
+}
+
+// alarmIsDisarmed returns true if no sensor triggers alarm in given mode, SOS and life-safety modes are not a disarm
+func alarmIsDisarmed(serviceConfig config.Config, alarmMode string) bool {
+	return alarmMode != alarmmanager.SOSMode && !alarmIsLifeSafety(serviceConfig, alarmMode) && !alarmIsArmed(serviceConfig, alarmMode)
+}
+
+// parseBypassUntil accepts RFC3339 times and durations relative to now
+func parseBypassUntil(value string, now time.Time) (time.Time, error) {
+	if until, timeErr := time.Parse(time.RFC3339, value); timeErr == nil {
+		return until, nil
+	}
+	duration, durationErr := time.ParseDuration(value)
+	if durationErr != nil {
+		return time.Time{}, fmt.Errorf("bypass until %q must be a RFC3339 time or a duration", value)
+	}
+	return now.Add(duration), nil
+}
+
+// newBypass validates bypass request
+func newBypass(request bypassRequest, now time.Time) (storage.Bypass, error) {
+	bypass := storage.Bypass{Sensor: request.Sensor, UntilDisarm: request.UntilDisarm, Created: now.Unix()}
+	switch {
+	case request.UntilDisarm && request.Until != "":
+		return bypass, errors.New("bypass accepts until or until_disarm, not both")
+	case !request.UntilDisarm && request.Until == "":
+		return bypass, errors.New("bypass requires until or until_disarm")
+	case !request.UntilDisarm:
+		until, untilErr := parseBypassUntil(request.Until, now)
+		if untilErr != nil {
+			return bypass, untilErr
+		}
+		if !until.After(now) {
+			return bypass, errors.New("bypass until must be in the future")
+		}
+		bypass.Until = until.Unix()
+	}
+	return bypass, nil
+}
+
+// applyBypass stores or clears sensor bypass and notifies it
+func (s service) applyBypass(ctx context.Context, request bypassRequest, now time.Time) (storage.Bypass, error) {
+	var bypass storage.Bypass
+	sensor, sensorIsManaged := s.config.Sensors[request.Sensor]
+	if !sensorIsManaged {
+		return bypass, fmt.Errorf("sensor %s is not declared in config", request.Sensor)
+	}
+	data := notifier.MessageData{SensorID: request.Sensor, Device: sensor.Device}
+
+	if request.Clear {
+		if clearErr := s.storage.ClearBypass(ctx, request.Sensor); clearErr != nil {
+			return bypass, clearErr
+		}
+		s.notifyBypass(notifier.MessageBypassCleared, data)
+		return bypass, nil
+	}
+
+	bypass, bypassErr := newBypass(request, now)
+	if bypassErr != nil {
+		return bypass, bypassErr
+	}
+	if setErr := s.storage.SetBypass(ctx, bypass); setErr != nil {
+		return bypass, setErr
+	}
+	messageKey := notifier.MessageBypassUntilDisarm
+	if !bypass.UntilDisarm {
+		messageKey = notifier.MessageBypassSet
+		data.Until = time.Unix(bypass.Until, 0).Format(bypassTimeLayout)
+	}
+	s.notifyBypass(messageKey, data)
+	return bypass, nil
+}
+
+func (s service) notifyBypass(messageKey string, data notifier.MessageData) {
+	bypassMessage := s.message(messageKey, data)
+	s.log.Info(bypassMessage, "sensor", data.SensorID)
+	s.send(notifier.Event{Type: notifier.EventBypass, Message: bypassMessage, Priority: normalPriority, Sensor: data.SensorID, Device: data.Device, Mode: data.Mode})
+}
+
+// handleBypassCommand applies bypass requests received on bypass command topic
+func (s service) handleBypassCommand(ctx context.Context, payload string) {
+	var request bypassRequest
+	if decodeErr := json.Unmarshal([]byte(payload), &request); decodeErr != nil {
+		s.log.Error("Failed to decode bypass command.", "error", decodeErr)
+		return
+	}
+	if _, bypassErr := s.applyBypass(ctx, request, time.Now()); bypassErr != nil {
+		s.log.Error("Failed to apply bypass command.", "sensor", request.Sensor, "error", bypassErr)
+	}
+}
+
+// handleModeChange checks arming readiness, clears until disarm bypasses on disarm and reports bypassed sensors when an arm mode is entered
+func (s service) handleModeChange(ctx context.Context, deviceID string, previousMode string, mode string) {
+	if !s.checkReadiness(ctx, deviceID, previousMode, mode) {
+		return
+	}
+	bypasses, listErr := s.storage.ListBypasses(ctx)
+	if listErr != nil {
+		s.log.Error("Failed to read sensor bypasses.", "device", deviceID, "error", listErr)
+		return
+	}
+	var bypassedSensors []string
+	for _, bypass := range bypasses {
+		sensor, sensorIsManaged := s.config.Sensors[bypass.Sensor]
+		if !sensorIsManaged || sensor.Device != deviceID {
+			continue
+		}
+		if alarmIsDisarmed(s.config, mode) {
+			if bypass.UntilDisarm {
+				if clearErr := s.storage.ClearBypass(ctx, bypass.Sensor); clearErr != nil {
+					s.log.Error("Failed to clear sensor bypass.", "sensor", bypass.Sensor, "error", clearErr)
+					continue
+				}
+				s.notifyBypass(notifier.MessageBypassCleared, notifier.MessageData{SensorID: bypass.Sensor, Device: deviceID, Mode: mode})
+			}
+			continue
+		}
+		if sensor.SensorTriggers[mode] {
+			bypassedSensors = append(bypassedSensors, sensor.FriendlyName)
+		}
+	}
+	if len(bypassedSensors) == 0 || !alarmIsArmed(s.config, mode) {
+		return
+	}
+	sort.Strings(bypassedSensors)
+	armedMessage := s.message(notifier.MessageBypassArmed, notifier.MessageData{Device: deviceID, Mode: mode, Sensors: strings.Join(bypassedSensors, ", ")})
+	s.log.Warn(armedMessage, "device", deviceID, "previous_mode", previousMode, "mode", mode)
+	s.send(notifier.Event{Type: notifier.EventBypass, Message: armedMessage, Priority: normalPriority, Device: deviceID, Mode: mode})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+func newBypassTestService(t *testing.T, memoryStorage *storage.MemoryStorage, sent *[]notifier.Event) service {
+	serviceConfig := readTestConfig(t)
+	messages, _ := notifier.NewCatalog(serviceConfig.Messages.Locale, nil)
+	return service{
+		config:  serviceConfig,
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage: memoryStorage,
+		sendFunc: func(event notifier.Event) error {
+			*sent = append(*sent, event)
+			return nil
+		},
+		messages: messages,
+	}
+}
+
+func TestParseBypassUntil(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	until, err := parseBypassUntil("2h", now)
+	if err != nil || !until.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("Duration should be added to now. Returned: %v, %v.", until, err)
+	}
+	until, err = parseBypassUntil("2024-05-01T18:00:00Z", now)
+	if err != nil || until.Hour() != 18 {
+		t.Errorf("RFC3339 time should be parsed. Returned: %v, %v.", until, err)
+	}
+	if _, err := parseBypassUntil("tomorrow", now); err == nil {
+		t.Error("Invalid until should fail.")
+	}
+}
+
+func TestApplyBypassValidation(t *testing.T) {
+	var sent []notifier.Event
+	bypassService := newBypassTestService(t, storage.NewMemoryStorage(), &sent)
+	ctx := context.Background()
+	now := time.Now()
+
+	if _, err := bypassService.applyBypass(ctx, bypassRequest{Sensor: "unknown", UntilDisarm: true}, now); err == nil {
+		t.Error("Bypass of undeclared sensor should fail.")
+	}
+	if _, err := bypassService.applyBypass(ctx, bypassRequest{Sensor: "door1"}, now); err == nil {
+		t.Error("Bypass without until should fail.")
+	}
+	if _, err := bypassService.applyBypass(ctx, bypassRequest{Sensor: "door1", Until: "-1h"}, now); err == nil {
+		t.Error("Bypass in the past should fail.")
+	}
+	if len(sent) != 0 {
+		t.Errorf("Invalid bypasses should not be notified. Returned: %v.", sent)
+	}
+}
+
+func TestHandleModeChangeBypasses(t *testing.T) {
+	var sent []notifier.Event
+	memoryStorage := storage.NewMemoryStorage()
+	bypassService := newBypassTestService(t, memoryStorage, &sent)
+	ctx := context.Background()
+	now := time.Now()
+
+	bypassService.applyBypass(ctx, bypassRequest{Sensor: "window1", UntilDisarm: true}, now)
+	bypassService.applyBypass(ctx, bypassRequest{Sensor: "motion1", Until: "1h"}, now)
+	sent = nil
+
+	bypassService.handleModeChange(ctx, "1", "disarmed", "home_armed")
+	if len(sent) != 1 || sent[0].Message != "Alarm status is home_armed with bypassed sensors: window1." {
+		t.Errorf("Bypassed sensors triggering in home_armed should be reported. Returned: %v.", sent)
+	}
+
+	sent = nil
+	bypassService.handleModeChange(ctx, "1", "home_armed", "disarmed")
+	bypasses, _ := memoryStorage.ListBypasses(ctx)
+	if len(bypasses) != 1 || bypasses[0].Sensor != "motion1" {
+		t.Errorf("Only timed bypass should remain after disarm. Returned: %+v.", bypasses)
+	}
+	if len(sent) != 1 || sent[0].Message != "Sensor 'window1' is no longer bypassed." {
+		t.Errorf("Cleared bypass should be notified. Returned: %v.", sent)
+	}
+}
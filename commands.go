@@ -0,0 +1,330 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	"golang.org/x/net/context"
+)
+
+// version is set at build time
+var version string = "dev"
+
+const configFlagUsage string = "config file directory, overrides ALARM_SENSORS_CONFIG_FILE_LOCATION"
+
+const usage string = `Usage: windmaker-alarmsensors [command] [flags]
+
+Commands:
+  run                   run service, default command
+  simulate              replay a sensor payloads timeline
+  config check          validate config and show sensors trigger matrix
+  state list            show stored status of every sensor
+  state get <sensor>    show stored status of a sensor
+  state reset <sensor>  remove stored status of a sensor
+  bypass list           show bypassed sensors
+  bypass set <sensor>   bypass a sensor, requires --until or --until-disarm
+  bypass clear <sensor> remove a sensor bypass
+  schedule <sensor>     preview when a sensor is active, accepts --mode and --days
+  version               show version
+
+Every command accepts --config flag.
+`
+
+// parseInterspersed parses flags placed before or after positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return positional, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func runCommand(args []string) int {
+	command := "run"
+	// Flags without command are run flags
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+	switch command {
+	case "run":
+		return runServiceCommand(args)
+	case "simulate":
+		return runSimulate(args)
+	case "config":
+		return runConfigCommand(args)
+	case "state":
+		return runStateCommand(args)
+	case "bypass":
+		return runBypassCommand(args)
+	case "schedule":
+		return runScheduleCommand(args)
+	case "version":
+		fmt.Printf("windmaker-alarmsensors %s\n", version)
+		return 0
+	case "help":
+		fmt.Print(usage)
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %s.\n", command)
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+func runServiceCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	configFileLocation := flags.String("config", "", configFlagUsage)
+	dryRun := flags.Bool("dry-run", false, "run full pipeline without changing alarm status")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	return runService(*configFileLocation, *dryRun)
+}
+
+func runConfigCommand(args []string) int {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	configFileLocation := flags.String("config", "", configFlagUsage)
+	positional, parseErr := parseInterspersed(flags, args)
+	if parseErr != nil {
+		return 2
+	}
+	if len(positional) != 1 || positional[0] != "check" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	serviceConfig, errConfig := config.ReadConfigFrom(*configFileLocation)
+	if errConfig != nil {
+		fmt.Fprintln(os.Stderr, errConfig.Error())
+		return 1
+	}
+	router, routerErr := buildTopicRouter(serviceConfig)
+	if routerErr != nil {
+		fmt.Fprintln(os.Stderr, routerErr.Error())
+		return 1
+	}
+	subscriptions := serviceConfig.Mqtt.Subscriptions
+	if len(subscriptions) == 0 {
+		subscriptions = router.Subscriptions()
+	}
+	subscriptions = append(subscriptions, availabilitySubscriptions(serviceConfig)...)
+	if serviceConfig.Bypass.CommandTopic != "" {
+		subscriptions = append(subscriptions, serviceConfig.Bypass.CommandTopic)
+	}
+
+	fmt.Println("Config is valid.")
+	fmt.Printf("\nMQTT subscriptions: %s\n", strings.Join(subscriptions, ", "))
+	printSensorMatrix(os.Stdout, serviceConfig)
+	return 0
+}
+
+func sortedSensorNames(serviceConfig config.Config) []string {
+	sensorNames := make([]string, 0, len(serviceConfig.Sensors))
+	for sensorName := range serviceConfig.Sensors {
+		sensorNames = append(sensorNames, sensorName)
+	}
+	sort.Strings(sensorNames)
+	return sensorNames
+}
+
+func printSensorMatrix(out io.Writer, serviceConfig config.Config) {
+	modes := make([]string, 0, len(serviceConfig.SensorTriggers))
+	for mode := range serviceConfig.SensorTriggers {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "\nSENSOR\tFRIENDLY NAME\tROOM\tTYPE\tDEVICE\tTOPIC\t"+strings.ToUpper(strings.Join(modes, "\t")))
+	for _, sensorName := range sortedSensorNames(serviceConfig) {
+		sensor := serviceConfig.Sensors[sensorName]
+		row := []string{sensor.Name, sensor.FriendlyName, valueOrDash(sensor.Room), valueOrDash(sensor.Type), sensor.Device, valueOrDash(sensor.Topic)}
+		for _, mode := range modes {
+			// 24h sensors trigger alarm in every mode
+			if sensor.Zone == config.ZoneLifeSafety {
+				row = append(row, "24h")
+			} else if sensor.SensorTriggers[mode] {
+				row = append(row, "x")
+			} else {
+				row = append(row, "-")
+			}
+		}
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	writer.Flush()
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func runStateCommand(args []string) int {
+	flags := flag.NewFlagSet("state", flag.ContinueOnError)
+	configFileLocation := flags.String("config", "", configFlagUsage)
+	positional, parseErr := parseInterspersed(flags, args)
+	if parseErr != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	subcommand := positional[0]
+	if (subcommand == "list" && len(positional) != 1) || ((subcommand == "get" || subcommand == "reset") && len(positional) != 2) {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	serviceConfig, errConfig := config.ReadConfigFrom(*configFileLocation)
+	if errConfig != nil {
+		fmt.Fprintln(os.Stderr, errConfig.Error())
+		return 1
+	}
+	ctx := context.Background()
+	newStorage := newReadOnlyRedisStorage
+	if subcommand == "reset" {
+		newStorage = newRedisStorage
+	}
+	storageInstance, redisErr := newStorage(ctx, serviceConfig)
+	if redisErr != nil {
+		fmt.Fprintln(os.Stderr, redisErr.Error())
+		return 1
+	}
+
+	sensorNames := sortedSensorNames(serviceConfig)
+	switch subcommand {
+	case "list":
+	case "get", "reset":
+		sensorName := positional[1]
+		if _, sensorIsManaged := serviceConfig.Sensors[sensorName]; !sensorIsManaged {
+			fmt.Fprintf(os.Stderr, "Sensor %s is not declared in config.\n", sensorName)
+			return 1
+		}
+		if subcommand == "reset" {
+			if resetErr := storageInstance.ResetSensorStatus(ctx, sensorName); resetErr != nil {
+				fmt.Fprintln(os.Stderr, resetErr.Error())
+				return 1
+			}
+			fmt.Printf("Sensor %s status has been reset.\n", sensorName)
+			return 0
+		}
+		sensorNames = []string{sensorName}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown state command %s.\n", subcommand)
+		return 2
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "SENSOR\tTRIGGERED\tONLINE\tFLAPPING\tLAST UPDATED")
+	for _, sensorName := range sensorNames {
+		sensorStatus, found, statusErr := storageInstance.GetSensorStatus(ctx, sensorName)
+		if statusErr != nil {
+			fmt.Fprintln(os.Stderr, statusErr.Error())
+			return 1
+		}
+		if !found {
+			fmt.Fprintf(writer, "%s\t-\t-\t-\tnever\n", sensorName)
+			continue
+		}
+		lastUpdated := time.Unix(sensorStatus.LastUpdated, 0).Format(time.RFC3339)
+		fmt.Fprintf(writer, "%s\t%t\t%t\t%t\t%s\n", sensorName, sensorStatus.Triggered, !sensorStatus.Offline, sensorStatus.Flapping, lastUpdated)
+	}
+	writer.Flush()
+	return 0
+}
+
+func runBypassCommand(args []string) int {
+	flags := flag.NewFlagSet("bypass", flag.ContinueOnError)
+	configFileLocation := flags.String("config", "", configFlagUsage)
+	until := flags.String("until", "", "bypass end, RFC3339 time or duration from now")
+	untilDisarm := flags.Bool("until-disarm", false, "bypass until alarm is disarmed")
+	positional, parseErr := parseInterspersed(flags, args)
+	if parseErr != nil {
+		return 2
+	}
+	if len(positional) == 0 || (positional[0] == "list" && len(positional) != 1) || ((positional[0] == "set" || positional[0] == "clear") && len(positional) != 2) {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	subcommand := positional[0]
+	if subcommand != "list" && subcommand != "set" && subcommand != "clear" {
+		fmt.Fprintf(os.Stderr, "Unknown bypass command %s.\n", subcommand)
+		return 2
+	}
+
+	serviceConfig, errConfig := config.ReadConfigFrom(*configFileLocation)
+	if errConfig != nil {
+		fmt.Fprintln(os.Stderr, errConfig.Error())
+		return 1
+	}
+	messages, messagesErr := notifier.NewCatalog(serviceConfig.Messages.Locale, serviceConfig.Messages.Templates)
+	if messagesErr != nil {
+		fmt.Fprintln(os.Stderr, messagesErr.Error())
+		return 1
+	}
+	ctx := context.Background()
+	newStorage := newRedisStorage
+	if subcommand == "list" {
+		newStorage = newReadOnlyRedisStorage
+	}
+	storageInstance, redisErr := newStorage(ctx, serviceConfig)
+	if redisErr != nil {
+		fmt.Fprintln(os.Stderr, redisErr.Error())
+		return 1
+	}
+
+	if subcommand == "list" {
+		bypasses, listErr := storageInstance.ListBypasses(ctx)
+		if listErr != nil {
+			fmt.Fprintln(os.Stderr, listErr.Error())
+			return 1
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "SENSOR\tUNTIL\tCREATED")
+		for _, bypass := range bypasses {
+			bypassUntil := "disarm"
+			if !bypass.UntilDisarm {
+				bypassUntil = time.Unix(bypass.Until, 0).Format(time.RFC3339)
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", bypass.Sensor, bypassUntil, time.Unix(bypass.Created, 0).Format(time.RFC3339))
+		}
+		writer.Flush()
+		return 0
+	}
+
+	// Bypass is stored for running service, notification text is shown instead of being sent
+	bypassService := service{
+		config:  serviceConfig,
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage: storageInstance,
+		sendFunc: func(event notifier.Event) error {
+			fmt.Println(event.Message)
+			return nil
+		},
+		messages: messages,
+	}
+	request := bypassRequest{Sensor: positional[1], Until: *until, UntilDisarm: *untilDisarm, Clear: subcommand == "clear"}
+	if _, bypassErr := bypassService.applyBypass(ctx, request, time.Now()); bypassErr != nil {
+		fmt.Fprintln(os.Stderr, bypassErr.Error())
+		return 1
+	}
+	return 0
+}
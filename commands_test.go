@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	flags := flag.NewFlagSet("state", flag.ContinueOnError)
+	configFileLocation := flags.String("config", "", configFlagUsage)
+
+	positional, err := parseInterspersed(flags, []string{"get", "door1", "--config", "/etc/windmaker-alarmsensors"})
+	if err != nil {
+		t.Fatalf("parseInterspersed should not fail, error was %s", err.Error())
+	}
+	if len(positional) != 2 || positional[0] != "get" || positional[1] != "door1" {
+		t.Errorf("Unexpected positional arguments %v.", positional)
+	}
+	if *configFileLocation != "/etc/windmaker-alarmsensors" {
+		t.Errorf("config flag should be parsed after positional arguments. Returned: %s.", *configFileLocation)
+	}
+}
+
+func TestPrintSensorMatrix(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	var out bytes.Buffer
+	printSensorMatrix(&out, serviceConfig)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Matrix should have header and 3 sensors. Output:\n%s", out.String())
+	}
+	if !strings.HasSuffix(lines[0], "ARMED  HOME_ARMED") {
+		t.Errorf("Unexpected header %s.", lines[0])
+	}
+	if strings.Join(strings.Fields(lines[2]), " ") != "motion1 motion1 - - 1 - x -" {
+		t.Errorf("Unexpected motion1 row %s.", lines[2])
+	}
+}
@@ -2,40 +2,170 @@ package config
 
 import (
 	"errors"
-
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	alarmsensors "github.com/a-castellano/AlarmSensors/alarmsensors"
+	logger "github.com/a-castellano/AlarmSensors/logger"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	rules "github.com/a-castellano/AlarmSensors/rules"
+	schedule "github.com/a-castellano/AlarmSensors/schedule"
 	viperLib "github.com/spf13/viper"
 )
 
 type Mqtt struct {
-	Host          string
-	Port          int
-	User          string
-	Password      string
-	WildcardTopic string
+	Host           string
+	Port           int
+	User           string
+	Password       string
+	WildcardTopic  string
+	TopicPatterns  []string
+	Subscriptions  []string
+	ClientID       string
+	ClientIDSuffix string
+	CleanSession   bool
+	QoS            byte
+	StatusTopic    string
 }
 
 type Rabbitmq struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	Queue    string
+	Host        string
+	Port        int
+	User        string
+	Password    string
+	Queue       string
+	MaxPriority int
+}
+
+type Log struct {
+	Level  string
+	Output string
+}
+
+type Zigbee2mqtt struct {
+	BaseTopic string
 }
 
 type AlarmManager struct {
-	Host     string
-	Port     int
-	DeviceId string
+	Host         string
+	Port         int
+	DeviceId     string
+	PollInterval time.Duration
+	FailSafe     string
+	FailSafeMode string
+}
+
+// Fallback configures SOS retries and alternative alerting channels
+type Fallback struct {
+	Retries      int
+	Backoff      time.Duration
+	SirenTopic   string
+	SirenPayload string
+	WebhookURL   string
+}
+
+// Notifications selects sinks which receive events
+type Notifications struct {
+	Sinks     []string
+	QueueSize int
+	MqttTopic string
+}
+
+// Messages selects notifications locale, templates override locale messages by message key
+type Messages struct {
+	Locale    string
+	Templates map[string]string
+}
+
+// RateLimit limits notifications per sensor and event type, zero values disable limits
+type RateLimit struct {
+	Window      time.Duration
+	MaxEvents   int
+	DedupWindow time.Duration
+}
+
+// Flapping detects sensors changing too often, detection is disabled when MaxTransitions is 0
+type Flapping struct {
+	MaxTransitions int
+	Window         time.Duration
+	StableAfter    time.Duration
+	Bypass         bool
+}
+
+// API configures HTTP API, it is disabled when Listen is empty
+type API struct {
+	Listen string
+	Token  string
+}
+
+// Bypass configures sensor bypass MQTT commands, they are disabled when CommandTopic is empty
+type Bypass struct {
+	CommandTopic string
+}
+
+// Readiness configures open sensors check when alarm is armed, Policy is notify, bypass, refuse or none
+type Readiness struct {
+	Policy string
+}
+
+// RuleEngine configures rules evaluation, History is how long sensor transitions are kept for rules
+type RuleEngine struct {
+	History time.Duration
+}
+
+// Sensor zones, intrusion sensors trigger alarm in their modes and 24h sensors always trigger
+const (
+	ZoneIntrusion  string = "intrusion"
+	ZoneLifeSafety string = "24h"
+)
+
+// LifeSafety configures 24h zones, Mode is set on alarmManager when a 24h sensor is activated
+type LifeSafety struct {
+	Mode string
+}
+
+// Action sensor commands
+const (
+	ActionPanic   string = "panic"
+	ActionArmHome string = "arm_home"
+	ActionDisarm  string = "disarm"
+	ActionDuress  string = "duress"
+)
+
+// Actions configures action sensor commands, disarm actions must be repeated within ConfirmWindow
+type Actions struct {
+	ArmHomeMode   string
+	DisarmMode    string
+	ConfirmWindow time.Duration
 }
 
 type Sensor struct {
 	Name           string
+	FriendlyName   string
+	Room           string
+	Type           string
+	Topic          string
+	Device         string
+	SilenceTimeout time.Duration
+	Debounce       alarmsensors.DebounceSettings
+	Schedule       *schedule.Schedule
+	// MaxOpenDuration enables left open alerts, repeated every OpenReminder when it is set
+	MaxOpenDuration time.Duration
+	OpenReminder    time.Duration
+	// Zone is intrusion or 24h, AlarmMode is the mode set by 24h sensors
+	Zone      string
+	AlarmMode string
+	// Actions maps action payload values of action sensors to commands
+	Actions        map[string]string
 	SensorTriggers map[string]bool
 }
 
 type SensorTrigger struct {
-	Name    string
-	Sensors map[string]*Sensor
+	Name     string
+	Sensors  map[string]*Sensor
+	Schedule *schedule.Schedule
 }
 
 type RedisServer struct {
@@ -52,10 +182,30 @@ type Config struct {
 	Sensors        map[string]*Sensor
 	SensorTriggers map[string]SensorTrigger
 	RedisServer    RedisServer
+	Zigbee2mqtt    Zigbee2mqtt
+	DryRun         bool
+	Log            Log
+	Fallback       Fallback
+	Webhooks       map[string]notifier.WebhookConfig
+	Notifications  Notifications
+	Messages       Messages
+	RateLimit      RateLimit
+	Flapping       Flapping
+	API            API
+	Bypass         Bypass
+	Readiness      Readiness
+	Rules          []rules.Rule
+	RuleEngine     RuleEngine
+	LifeSafety     LifeSafety
+	Actions        Actions
 }
 
 func ReadConfig() (Config, error) {
-	var configFileLocation string
+	return ReadConfigFrom("")
+}
+
+// ReadConfigFrom reads config from given location, env variable is used when location is empty
+func ReadConfigFrom(configFileLocation string) (Config, error) {
 	var config Config
 
 	var envVariable string = "ALARM_SENSORS_CONFIG_FILE_LOCATION"
@@ -65,12 +215,19 @@ func ReadConfig() (Config, error) {
 	rabbitmqRequiredVariables := []string{"host", "port", "user", "password", "queue"}
 	alarmManagerRequiredVariables := []string{"host", "port", "deviceid"}
 	redisRequiredVariables := []string{"ip", "port", "password", "database"}
+	validSensorTypes := map[string]bool{"": true, "contact": true, "motion": true, "water_leak": true, "smoke": true, "carbon_monoxide": true, "action": true}
+	validActions := map[string]bool{ActionPanic: true, ActionArmHome: true, ActionDisarm: true, ActionDuress: true}
+	// Life-safety sensor types are 24h zones unless zone is declared
+	lifeSafetyTypes := map[string]bool{"water_leak": true, "smoke": true, "carbon_monoxide": true}
+	validSinks := map[string]bool{"rabbitmq": true, "webhooks": true, "mqtt": true, "log": true}
 
 	viper := viperLib.New()
 
 	//Look for config file location defined as env var
-	viper.BindEnv(envVariable)
-	configFileLocation = viper.GetString(envVariable)
+	if configFileLocation == "" {
+		viper.BindEnv(envVariable)
+		configFileLocation = viper.GetString(envVariable)
+	}
 	if configFileLocation == "" {
 		// Get config file from default location
 		return config, errors.New(errors.New("Environment variable SECURITY_CAM_BOT_CONFIG_FILE_LOCATION is not defined.").Error())
@@ -85,12 +242,20 @@ func ReadConfig() (Config, error) {
 	}
 
 	for _, requiredVariable := range requiredVariables {
+		// Sensor triggers can be declared from sensors table instead
+		if requiredVariable == "sensor_triggers" && viper.IsSet("sensors") {
+			continue
+		}
 		if !viper.IsSet(requiredVariable) {
 			return config, errors.New("Fatal error config: no " + requiredVariable + " field was found.")
 		}
 	}
 
 	for _, mqttVariable := range mqttRequiredVariables {
+		// Wildcard topic is not required when topic patterns are declared
+		if mqttVariable == "wildcard_topic" && viper.IsSet("mqtt.topic_patterns") {
+			continue
+		}
 		if !viper.IsSet("mqtt." + mqttVariable) {
 			return config, errors.New("Fatal error config: no mqtt " + mqttVariable + " was found.")
 		}
@@ -143,15 +308,417 @@ func ReadConfig() (Config, error) {
 		//Check if sensor already exists
 	}
 
+	// Sensor centric declarations, merged with trigger centric ones
+	readedSensorTables := viper.GetStringMap("sensors")
+
+	for readedSensorTableName := range readedSensorTables {
+		sensorKey := "sensors." + readedSensorTableName
+		// Table names are lowercased by the parser, name field keeps original case
+		sensorName := readedSensorTableName
+		if viper.IsSet(sensorKey + ".name") {
+			sensorName = viper.GetString(sensorKey + ".name")
+		}
+		if _, ok := readedSensorNames[sensorName]; !ok {
+			readedSensorNames[sensorName] = true
+			newSensor := Sensor{Name: sensorName}
+			newSensor.SensorTriggers = make(map[string]bool)
+			sensors[sensorName] = &newSensor
+		}
+		sensor := sensors[sensorName]
+
+		sensor.FriendlyName = viper.GetString(sensorKey + ".friendly_name")
+		sensor.Room = viper.GetString(sensorKey + ".room")
+		sensor.Type = viper.GetString(sensorKey + ".type")
+		sensor.Topic = viper.GetString(sensorKey + ".topic")
+		sensor.Device = viper.GetString(sensorKey + ".device")
+		sensor.SilenceTimeout = viper.GetDuration(sensorKey + ".silence_timeout")
+		sensor.Debounce = alarmsensors.DebounceSettings{Duration: viper.GetDuration(sensorKey + ".debounce"), OccupancyCount: viper.GetInt(sensorKey + ".occupancy_count")}
+
+		if _, validType := validSensorTypes[sensor.Type]; !validType {
+			return config, errors.New("Fatal error config: sensor " + sensorName + " has invalid type " + sensor.Type + ".")
+		}
+		if sensor.SilenceTimeout < 0 {
+			return config, errors.New("Fatal error config: sensor " + sensorName + " has negative silence_timeout.")
+		}
+		if sensor.Debounce.Duration < 0 || sensor.Debounce.OccupancyCount < 0 {
+			return config, errors.New("Fatal error config: sensor " + sensorName + " has negative debounce or occupancy_count.")
+		}
+		sensor.MaxOpenDuration = viper.GetDuration(sensorKey + ".max_open_duration")
+		sensor.OpenReminder = viper.GetDuration(sensorKey + ".open_reminder")
+		if sensor.MaxOpenDuration < 0 || sensor.OpenReminder < 0 {
+			return config, errors.New("Fatal error config: sensor " + sensorName + " has negative max_open_duration or open_reminder.")
+		}
+		if sensor.MaxOpenDuration > 0 && sensor.Type != "" && sensor.Type != "contact" {
+			return config, errors.New("Fatal error config: sensor " + sensorName + " is a " + sensor.Type + " sensor, max_open_duration requires a contact sensor.")
+		}
+		if sensor.OpenReminder > 0 && sensor.MaxOpenDuration == 0 {
+			return config, errors.New("Fatal error config: sensor " + sensorName + " open_reminder requires max_open_duration.")
+		}
+		sensor.Zone = viper.GetString(sensorKey + ".zone")
+		if sensor.Zone == "" && lifeSafetyTypes[sensor.Type] {
+			sensor.Zone = ZoneLifeSafety
+		}
+		sensor.AlarmMode = viper.GetString(sensorKey + ".alarm_mode")
+		switch sensor.Zone {
+		case "", ZoneIntrusion:
+			if sensor.AlarmMode != "" {
+				return config, errors.New("Fatal error config: sensor " + sensorName + " alarm_mode requires a 24h zone.")
+			}
+		case ZoneLifeSafety:
+			if viper.IsSet(sensorKey + ".schedule") {
+				return config, errors.New("Fatal error config: sensor " + sensorName + " is a 24h zone, it cannot declare schedule.")
+			}
+		default:
+			return config, errors.New("Fatal error config: sensor " + sensorName + " has invalid zone " + sensor.Zone + ", it must be intrusion or 24h.")
+		}
+		// Action names are lowercased by the parser, received actions are lowercased too
+		sensor.Actions = viper.GetStringMapString(sensorKey + ".actions")
+		if (sensor.Type == "action") != (len(sensor.Actions) > 0) {
+			return config, errors.New("Fatal error config: sensor " + sensorName + " actions require an action sensor and action sensors require actions.")
+		}
+		for action, command := range sensor.Actions {
+			if !validActions[command] {
+				return config, errors.New("Fatal error config: sensor " + sensorName + " action " + action + " has invalid command " + command + ", it must be panic, arm_home, disarm or duress.")
+			}
+		}
+		if viper.IsSet(sensorKey + ".schedule") {
+			sensorSchedule, scheduleErr := readSchedule(viper, sensorKey)
+			if scheduleErr != nil {
+				return config, errors.New("Fatal error config: sensor " + sensorName + " " + scheduleErr.Error() + ".")
+			}
+			sensor.Schedule = sensorSchedule
+		}
+
+		for _, sensorMode := range viper.GetStringSlice(sensorKey + ".modes") {
+			if _, ok := sensorTriggers[sensorMode]; !ok {
+				newSensorTrigger := SensorTrigger{Name: sensorMode}
+				newSensorTrigger.Sensors = make(map[string]*Sensor)
+				sensorTriggers[sensorMode] = newSensorTrigger
+			}
+			sensor.SensorTriggers[sensorMode] = true
+			sensorTriggers[sensorMode].Sensors[sensorName] = sensor
+		}
+	}
+
+	// Table names are lowercased, so a sensor table without name field never matches a capitalized sensor
+	sensorNames := make([]string, 0, len(sensors))
+	for sensorName := range sensors {
+		sensorNames = append(sensorNames, sensorName)
+	}
+	sort.Strings(sensorNames)
+	lowercasedNames := make(map[string]string)
+	for _, sensorName := range sensorNames {
+		if otherName, found := lowercasedNames[strings.ToLower(sensorName)]; found {
+			return config, errors.New("Fatal error config: sensors " + otherName + " and " + sensorName + " differ only by case, declare name field in sensors table.")
+		}
+		lowercasedNames[strings.ToLower(sensorName)] = sensorName
+	}
+
+	for sensorTriggerName, sensorTrigger := range sensorTriggers {
+		triggerKey := "sensor_triggers." + sensorTriggerName
+		if !viper.IsSet(triggerKey + ".schedule") {
+			continue
+		}
+		triggerSchedule, scheduleErr := readSchedule(viper, triggerKey)
+		if scheduleErr != nil {
+			return config, errors.New("Fatal error config: sensor trigger " + sensorTriggerName + " " + scheduleErr.Error() + ".")
+		}
+		sensorTrigger.Schedule = triggerSchedule
+		sensorTriggers[sensorTriggerName] = sensorTrigger
+	}
+
 	rabbitmqConfig := Rabbitmq{Host: viper.GetString("rabbitmq.host"), Port: viper.GetInt("rabbitmq.port"), User: viper.GetString("rabbitmq.user"), Password: viper.GetString("rabbitmq.password"), Queue: viper.GetString("rabbitmq.queue")}
 
 	mqttConfig := Mqtt{Host: viper.GetString("mqtt.host"), Port: viper.GetInt("mqtt.port"), User: viper.GetString("mqtt.user"), Password: viper.GetString("mqtt.password"), WildcardTopic: viper.GetString("mqtt.wildcard_topic")}
+	mqttConfig.TopicPatterns = viper.GetStringSlice("mqtt.topic_patterns")
+	mqttConfig.Subscriptions = viper.GetStringSlice("mqtt.subscriptions")
+
+	viper.SetDefault("mqtt.client_id", "windmaker_alarmsensors")
+	viper.SetDefault("mqtt.clean_session", true)
+	viper.SetDefault("mqtt.qos", 1)
+	viper.SetDefault("mqtt.status_topic", "alarmsensors/status")
+	mqttConfig.ClientID = viper.GetString("mqtt.client_id")
+	mqttConfig.ClientIDSuffix = viper.GetString("mqtt.client_id_suffix")
+	mqttConfig.CleanSession = viper.GetBool("mqtt.clean_session")
+	mqttQoS := viper.GetInt("mqtt.qos")
+	mqttConfig.StatusTopic = viper.GetString("mqtt.status_topic")
+
+	if mqttQoS < 0 || mqttQoS > 2 {
+		return config, errors.New("Fatal error config: mqtt qos must be 0, 1 or 2.")
+	}
+	mqttConfig.QoS = byte(mqttQoS)
+	if mqttConfig.ClientIDSuffix != "" && mqttConfig.ClientIDSuffix != "hostname" && mqttConfig.ClientIDSuffix != "random" {
+		return config, errors.New("Fatal error config: mqtt client_id_suffix must be hostname or random.")
+	}
+	if !mqttConfig.CleanSession && mqttConfig.ClientIDSuffix == "random" {
+		return config, errors.New("Fatal error config: mqtt persistent sessions require a stable client_id, random suffix is not allowed.")
+	}
+
+	if mqttConfig.WildcardTopic != "" {
+		if _, err := alarmsensors.WildcardTopicPattern(mqttConfig.WildcardTopic); err != nil {
+			return config, errors.New("Fatal error config: invalid mqtt wildcard_topic: " + err.Error())
+		}
+	}
+	if mqttConfig.StatusTopic != "" {
+		if _, err := alarmsensors.ParseTopicFilter(mqttConfig.StatusTopic); err != nil || strings.ContainsAny(mqttConfig.StatusTopic, "+#") {
+			return config, errors.New("Fatal error config: mqtt status_topic must be a topic without wildcards.")
+		}
+	}
+	for _, subscription := range mqttConfig.Subscriptions {
+		if _, err := alarmsensors.ParseTopicFilter(subscription); err != nil {
+			return config, errors.New("Fatal error config: invalid mqtt subscription: " + err.Error())
+		}
+	}
+	for _, topicPattern := range mqttConfig.TopicPatterns {
+		if err := alarmsensors.ValidateTopicPattern(topicPattern); err != nil {
+			return config, errors.New("Fatal error config: invalid mqtt topic pattern: " + err.Error())
+		}
+		if !strings.Contains("/"+topicPattern+"/", "/{sensor}/") {
+			return config, errors.New("Fatal error config: mqtt topic pattern " + topicPattern + " has no {sensor} capture.")
+		}
+	}
+	for sensorName, sensor := range sensors {
+		if sensor.Topic == "" {
+			continue
+		}
+		if err := alarmsensors.ValidateTopicPattern(sensor.Topic); err != nil {
+			return config, errors.New("Fatal error config: invalid topic for sensor " + sensorName + ": " + err.Error())
+		}
+	}
+
+	rabbitmqConfig.MaxPriority = viper.GetInt("rabbitmq.max_priority")
+	if rabbitmqConfig.MaxPriority < 0 || rabbitmqConfig.MaxPriority > 255 {
+		return config, errors.New("Fatal error config: rabbitmq max_priority must be between 0 and 255.")
+	}
 
 	alarmManagerConfig := AlarmManager{Host: viper.GetString("alarmmanager.host"), Port: viper.GetInt("alarmmanager.port"), DeviceId: viper.GetString("alarmmanager.deviceid")}
 
+	viper.SetDefault("alarmmanager.poll_interval", "5s")
+	viper.SetDefault("alarmmanager.failsafe", "last_known")
+	alarmManagerConfig.PollInterval = viper.GetDuration("alarmmanager.poll_interval")
+	alarmManagerConfig.FailSafe = viper.GetString("alarmmanager.failsafe")
+	alarmManagerConfig.FailSafeMode = viper.GetString("alarmmanager.failsafe_mode")
+	if alarmManagerConfig.PollInterval <= 0 {
+		return config, errors.New("Fatal error config: alarmManager poll_interval must be greater than 0.")
+	}
+	switch alarmManagerConfig.FailSafe {
+	case "last_known", "none":
+	case "armed":
+		if alarmManagerConfig.FailSafeMode == "" {
+			return config, errors.New("Fatal error config: alarmManager armed failsafe requires failsafe_mode.")
+		}
+	default:
+		return config, errors.New("Fatal error config: alarmManager failsafe must be last_known, armed or none.")
+	}
+
+	viper.SetDefault("fallback.retries", 3)
+	viper.SetDefault("fallback.backoff", "1s")
+	viper.SetDefault("fallback.siren_payload", "ON")
+	fallbackConfig := Fallback{Retries: viper.GetInt("fallback.retries"), Backoff: viper.GetDuration("fallback.backoff"), SirenTopic: viper.GetString("fallback.siren_topic"), SirenPayload: viper.GetString("fallback.siren_payload"), WebhookURL: viper.GetString("fallback.webhook_url")}
+	if fallbackConfig.Retries < 0 {
+		return config, errors.New("Fatal error config: fallback retries must not be negative.")
+	}
+	if fallbackConfig.Backoff <= 0 {
+		return config, errors.New("Fatal error config: fallback backoff must be greater than 0.")
+	}
+	if fallbackConfig.SirenTopic != "" {
+		if _, err := alarmsensors.ParseTopicFilter(fallbackConfig.SirenTopic); err != nil || strings.ContainsAny(fallbackConfig.SirenTopic, "+#") {
+			return config, errors.New("Fatal error config: fallback siren_topic must be a topic without wildcards.")
+		}
+	}
+	if fallbackConfig.WebhookURL != "" && !strings.HasPrefix(fallbackConfig.WebhookURL, "http://") && !strings.HasPrefix(fallbackConfig.WebhookURL, "https://") {
+		return config, errors.New("Fatal error config: fallback webhook_url must be an http or https URL.")
+	}
+
+	// Webhooks are optional, each one is declared in its own table
+	webhooks := make(map[string]notifier.WebhookConfig)
+	for webhookName := range viper.GetStringMap("webhooks") {
+		webhookKey := "webhooks." + webhookName
+		viper.SetDefault(webhookKey+".retries", 3)
+		viper.SetDefault(webhookKey+".backoff", "1s")
+		viper.SetDefault(webhookKey+".timeout", "5s")
+		webhook := notifier.WebhookConfig{URL: viper.GetString(webhookKey + ".url"), Method: strings.ToUpper(viper.GetString(webhookKey + ".method")), Events: viper.GetStringSlice(webhookKey + ".events"), Headers: viper.GetStringMapString(webhookKey + ".headers"), ContentType: viper.GetString(webhookKey + ".content_type"), Body: viper.GetString(webhookKey + ".body"), Secret: viper.GetString(webhookKey + ".secret"), SignatureHeader: viper.GetString(webhookKey + ".signature_header")}
+		webhook.Retries = viper.GetInt(webhookKey + ".retries")
+		webhook.Backoff = viper.GetDuration(webhookKey + ".backoff")
+		webhook.Timeout = viper.GetDuration(webhookKey + ".timeout")
+		if !strings.HasPrefix(webhook.URL, "http://") && !strings.HasPrefix(webhook.URL, "https://") {
+			return config, errors.New("Fatal error config: webhook " + webhookName + " url must be an http or https URL.")
+		}
+		for _, eventType := range webhook.Events {
+			if !notifier.ValidEventType(eventType) {
+				return config, errors.New("Fatal error config: webhook " + webhookName + " has unknown event " + eventType + ".")
+			}
+		}
+		if _, err := notifier.ParseBodyTemplate(webhook.Body); err != nil {
+			return config, errors.New("Fatal error config: webhook " + webhookName + " has invalid body template: " + err.Error())
+		}
+		if webhook.Retries < 0 || webhook.Backoff <= 0 || webhook.Timeout <= 0 {
+			return config, errors.New("Fatal error config: webhook " + webhookName + " retries must not be negative, backoff and timeout must be greater than 0.")
+		}
+		webhooks[webhookName] = webhook
+	}
+	config.Webhooks = webhooks
+
+	// Rules are optional, each one is declared in its own table
+	for ruleName := range viper.GetStringMap("rules") {
+		ruleKey := "rules." + ruleName
+		viper.SetDefault(ruleKey+".device", alarmManagerConfig.DeviceId)
+		rule := rules.Rule{Name: ruleName, When: viper.GetString(ruleKey + ".when"), Action: viper.GetString(ruleKey + ".action"), Device: viper.GetString(ruleKey + ".device"), Message: viper.GetString(ruleKey + ".message"), HighPriority: viper.GetBool(ruleKey + ".high_priority"), Mode: viper.GetString(ruleKey + ".mode"), Topic: viper.GetString(ruleKey + ".topic"), Payload: viper.GetString(ruleKey + ".payload"), Cooldown: viper.GetDuration(ruleKey + ".cooldown")}
+		if rule.Topic != "" {
+			if _, err := alarmsensors.ParseTopicFilter(rule.Topic); err != nil || strings.ContainsAny(rule.Topic, "+#") {
+				return config, errors.New("Fatal error config: rule " + ruleName + " topic must be a topic without wildcards.")
+			}
+		}
+		if rule.Cooldown < 0 {
+			return config, errors.New("Fatal error config: rule " + ruleName + " has negative cooldown.")
+		}
+		config.Rules = append(config.Rules, rule)
+	}
+	if _, err := rules.NewEngine(config.Rules); err != nil {
+		return config, errors.New("Fatal error config: " + err.Error() + ".")
+	}
+	viper.SetDefault("rule_engine.history", "1h")
+	config.RuleEngine = RuleEngine{History: viper.GetDuration("rule_engine.history")}
+	if config.RuleEngine.History <= 0 {
+		return config, errors.New("Fatal error config: rule_engine history must be greater than 0.")
+	}
+
+	viper.SetDefault("notifications.sinks", []string{"rabbitmq", "webhooks"})
+	viper.SetDefault("notifications.queue_size", 100)
+	viper.SetDefault("notifications.mqtt_topic", "alarmsensors/events")
+	notificationsConfig := Notifications{Sinks: viper.GetStringSlice("notifications.sinks"), QueueSize: viper.GetInt("notifications.queue_size"), MqttTopic: strings.TrimSuffix(viper.GetString("notifications.mqtt_topic"), "/")}
+	for _, sinkName := range notificationsConfig.Sinks {
+		if _, validSink := validSinks[sinkName]; !validSink {
+			return config, errors.New("Fatal error config: invalid notifications sink " + sinkName + ", it must be rabbitmq, webhooks, mqtt or log.")
+		}
+	}
+	if notificationsConfig.QueueSize <= 0 {
+		return config, errors.New("Fatal error config: notifications queue_size must be greater than 0.")
+	}
+	if _, err := alarmsensors.ParseTopicFilter(notificationsConfig.MqttTopic); err != nil || strings.ContainsAny(notificationsConfig.MqttTopic, "+#") {
+		return config, errors.New("Fatal error config: notifications mqtt_topic must be a topic without wildcards.")
+	}
+	config.Notifications = notificationsConfig
+
+	viper.SetDefault("rate_limit.window", "5m")
+	rateLimitConfig := RateLimit{Window: viper.GetDuration("rate_limit.window"), MaxEvents: viper.GetInt("rate_limit.max_events"), DedupWindow: viper.GetDuration("rate_limit.dedup_window")}
+	if rateLimitConfig.Window <= 0 || rateLimitConfig.MaxEvents < 0 || rateLimitConfig.DedupWindow < 0 {
+		return config, errors.New("Fatal error config: rate_limit window must be greater than 0, max_events and dedup_window must not be negative.")
+	}
+	config.RateLimit = rateLimitConfig
+
+	viper.SetDefault("flapping.window", "1m")
+	viper.SetDefault("flapping.stable_after", "5m")
+	flappingConfig := Flapping{MaxTransitions: viper.GetInt("flapping.max_transitions"), Window: viper.GetDuration("flapping.window"), StableAfter: viper.GetDuration("flapping.stable_after"), Bypass: viper.GetBool("flapping.bypass")}
+	if flappingConfig.MaxTransitions < 0 || flappingConfig.Window <= 0 || flappingConfig.StableAfter <= 0 {
+		return config, errors.New("Fatal error config: flapping max_transitions must not be negative, window and stable_after must be greater than 0.")
+	}
+	config.Flapping = flappingConfig
+
+	config.API = API{Listen: viper.GetString("api.listen"), Token: viper.GetString("api.token")}
+	if config.API.Listen != "" {
+		apiHost, _, splitErr := net.SplitHostPort(config.API.Listen)
+		if splitErr != nil {
+			return config, errors.New("Fatal error config: api listen must be a host:port address.")
+		}
+		// Bypasses disable intrusion sensors, API without token is only served on loopback
+		if config.API.Token == "" && !loopbackHost(apiHost) {
+			return config, errors.New("Fatal error config: api token is required when api listen is not a loopback address.")
+		}
+	}
+	config.Bypass = Bypass{CommandTopic: viper.GetString("bypass.command_topic")}
+	if config.Bypass.CommandTopic != "" {
+		if _, err := alarmsensors.ParseTopicFilter(config.Bypass.CommandTopic); err != nil || strings.ContainsAny(config.Bypass.CommandTopic, "+#") {
+			return config, errors.New("Fatal error config: bypass command_topic must be a topic without wildcards.")
+		}
+	}
+
+	viper.SetDefault("readiness.policy", "notify")
+	config.Readiness = Readiness{Policy: viper.GetString("readiness.policy")}
+	switch config.Readiness.Policy {
+	case "notify", "bypass", "refuse", "none":
+	default:
+		return config, errors.New("Fatal error config: readiness policy must be notify, bypass, refuse or none.")
+	}
+
+	// Message templates are declared as messages.<event type> or messages.<event type>.<variant>
+	viper.SetDefault("messages.locale", notifier.DefaultLocale)
+	messagesConfig := Messages{Locale: viper.GetString("messages.locale"), Templates: make(map[string]string)}
+	for _, messageKey := range viper.AllKeys() {
+		if strings.HasPrefix(messageKey, "messages.") && messageKey != "messages.locale" {
+			messagesConfig.Templates[strings.TrimPrefix(messageKey, "messages.")] = viper.GetString(messageKey)
+		}
+	}
+	if _, err := notifier.NewCatalog(messagesConfig.Locale, messagesConfig.Templates); err != nil {
+		return config, errors.New("Fatal error config: invalid messages: " + err.Error())
+	}
+	config.Messages = messagesConfig
+
 	config.Rabbitmq = rabbitmqConfig
 	config.Mqtt = mqttConfig
 	config.AlarmManager = alarmManagerConfig
+	config.Fallback = fallbackConfig
+
+	// Zigbee2MQTT availability integration is optional
+	if viper.IsSet("zigbee2mqtt") {
+		if !viper.IsSet("zigbee2mqtt.base_topic") {
+			return config, errors.New("Fatal error config: no zigbee2mqtt base_topic was found.")
+		}
+		config.Zigbee2mqtt.BaseTopic = strings.TrimSuffix(viper.GetString("zigbee2mqtt.base_topic"), "/")
+		if _, err := alarmsensors.ParseTopicFilter(config.Zigbee2mqtt.BaseTopic); err != nil || strings.ContainsAny(config.Zigbee2mqtt.BaseTopic, "+#") {
+			return config, errors.New("Fatal error config: zigbee2mqtt base_topic must be a topic without wildcards.")
+		}
+	}
+
+	config.DryRun = viper.GetBool("dry_run")
+
+	config.Log.Level = viper.GetString("log.level")
+	config.Log.Output = viper.GetString("log.output")
+	if _, err := logger.ParseLevel(config.Log.Level); err != nil {
+		return config, errors.New("Fatal error config: invalid log level " + config.Log.Level + ".")
+	}
+	if !logger.ValidOutput(config.Log.Output) {
+		return config, errors.New("Fatal error config: invalid log output " + config.Log.Output + ", it must be journald, json, text or syslog.")
+	}
+
+	viper.SetDefault("life_safety.mode", "FIRE")
+	config.LifeSafety = LifeSafety{Mode: viper.GetString("life_safety.mode")}
+	if config.LifeSafety.Mode == "" {
+		return config, errors.New("Fatal error config: life_safety mode must not be empty.")
+	}
+
+	viper.SetDefault("actions.arm_home_mode", "home_armed")
+	viper.SetDefault("actions.disarm_mode", "disarmed")
+	viper.SetDefault("actions.confirm_window", "10s")
+	config.Actions = Actions{ArmHomeMode: viper.GetString("actions.arm_home_mode"), DisarmMode: viper.GetString("actions.disarm_mode"), ConfirmWindow: viper.GetDuration("actions.confirm_window")}
+	if config.Actions.ArmHomeMode == "" || config.Actions.DisarmMode == "" || config.Actions.ConfirmWindow <= 0 {
+		return config, errors.New("Fatal error config: actions arm_home_mode and disarm_mode must not be empty, confirm_window must be greater than 0.")
+	}
+
+	// Apply sensor defaults
+	for _, sensor := range sensors {
+		if len(sensor.Actions) > 0 && len(sensor.SensorTriggers) > 0 {
+			return config, errors.New("Fatal error config: sensor " + sensor.Name + " is an action sensor, it cannot be declared in alarm modes.")
+		}
+		if sensor.Zone == "" {
+			sensor.Zone = ZoneIntrusion
+		}
+		if sensor.Zone == ZoneLifeSafety {
+			// 24h sensors always trigger, alarm modes do not apply to them
+			if len(sensor.SensorTriggers) > 0 {
+				return config, errors.New("Fatal error config: sensor " + sensor.Name + " is a 24h zone, it cannot be declared in alarm modes.")
+			}
+			if sensor.AlarmMode == "" {
+				sensor.AlarmMode = config.LifeSafety.Mode
+			}
+		}
+		if sensor.FriendlyName == "" {
+			sensor.FriendlyName = sensor.Name
+		}
+		if sensor.Device == "" {
+			sensor.Device = alarmManagerConfig.DeviceId
+		}
+	}
 
 	config.Sensors = sensors
 	config.SensorTriggers = sensorTriggers
@@ -170,3 +737,29 @@ func ReadConfig() (Config, error) {
 
 	return config, nil
 }
+
+// readSchedule reads schedule windows and timezone declared under key, local timezone is used by default
+func readSchedule(viper *viperLib.Viper, key string) (*schedule.Schedule, error) {
+	location := time.Local
+	if timezone := viper.GetString(key + ".timezone"); timezone != "" {
+		loadedLocation, locationErr := time.LoadLocation(timezone)
+		if locationErr != nil {
+			return nil, errors.New("has invalid timezone " + timezone)
+		}
+		location = loadedLocation
+	}
+	parsedSchedule, scheduleErr := schedule.Parse(viper.GetStringSlice(key+".schedule"), location)
+	if scheduleErr != nil {
+		return nil, errors.New("has invalid schedule: " + scheduleErr.Error())
+	}
+	return parsedSchedule, nil
+}
+
+// loopbackHost returns true if host is localhost or a loopback IP, empty host listens on every interface
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestProcessConfigNoMqtt(t *testing.T) {
@@ -62,6 +64,27 @@ func TestOKConfig(t *testing.T) {
 	if config.Mqtt.Host != "localhost" {
 		t.Errorf("Mqtt Mqtt should be localhost. Returned: %s.", config.Mqtt.Host)
 	}
+	if config.DryRun != false {
+		t.Errorf("DryRun should be disabled by default.")
+	}
+	if config.AlarmManager.PollInterval != 5*time.Second || config.AlarmManager.FailSafe != "last_known" {
+		t.Errorf("Unexpected alarmManager tracking defaults %+v.", config.AlarmManager)
+	}
+	if config.Mqtt.StatusTopic != "alarmsensors/status" {
+		t.Errorf("Mqtt StatusTopic should default to alarmsensors/status. Returned: %s.", config.Mqtt.StatusTopic)
+	}
+	if config.Mqtt.ClientID != "windmaker_alarmsensors" || config.Mqtt.QoS != 1 || config.Mqtt.CleanSession != true {
+		t.Errorf("Mqtt session defaults are not applied. Returned: %s, %d, %t.", config.Mqtt.ClientID, config.Mqtt.QoS, config.Mqtt.CleanSession)
+	}
+	if len(config.Notifications.Sinks) != 2 || config.Notifications.QueueSize != 100 || config.Notifications.MqttTopic != "alarmsensors/events" {
+		t.Errorf("Unexpected notifications defaults %+v.", config.Notifications)
+	}
+	if config.RateLimit.Window != 5*time.Minute || config.RateLimit.MaxEvents != 0 || config.RateLimit.DedupWindow != 0 {
+		t.Errorf("Rate limit should be disabled by default. Returned: %+v.", config.RateLimit)
+	}
+	if config.Fallback.Retries != 3 || config.Fallback.Backoff != time.Second || config.Fallback.SirenTopic != "" {
+		t.Errorf("Unexpected fallback defaults %+v.", config.Fallback)
+	}
 	if len(config.SensorTriggers) != 2 {
 		t.Errorf("SensorTriggers length should be 2. Returned: %d.", len(config.SensorTriggers))
 	}
@@ -73,3 +96,366 @@ func TestOKConfig(t *testing.T) {
 		t.Errorf("doorSensor Name should be door1. Returned: %s.", doorSensor.Name)
 	}
 }
+
+func TestSensorsConfig(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_sensors/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig with sensors config shouln't return errors. Returned: %s.", err.Error())
+	}
+	if len(config.Sensors) != 7 {
+		t.Errorf("Sensors length should be 7. Returned: %d.", len(config.Sensors))
+	}
+	if len(config.SensorTriggers) != 3 {
+		t.Errorf("SensorTriggers length should be 3. Returned: %d.", len(config.SensorTriggers))
+	}
+	doorSensor := config.Sensors["door1"]
+	if doorSensor.FriendlyName != "Front door" {
+		t.Errorf("door1 FriendlyName should be 'Front door'. Returned: %s.", doorSensor.FriendlyName)
+	}
+	if doorSensor.SilenceTimeout != 2*time.Hour {
+		t.Errorf("door1 SilenceTimeout should be 2h. Returned: %s.", doorSensor.SilenceTimeout)
+	}
+	if len(doorSensor.SensorTriggers) != 3 {
+		t.Errorf("door1 should be armed in 3 modes. Returned: %d.", len(doorSensor.SensorTriggers))
+	}
+	if doorSensor.Device != "1" {
+		t.Errorf("door1 Device should default to '1'. Returned: %s.", doorSensor.Device)
+	}
+	if doorSensor.Schedule == nil || len(doorSensor.Schedule.Windows) != 2 || doorSensor.Schedule.Location.String() != "Europe/Madrid" {
+		t.Errorf("door1 should have two schedule windows in Europe/Madrid. Returned: %v.", doorSensor.Schedule)
+	}
+	if config.SensorTriggers["home_armed"].Schedule == nil || config.SensorTriggers["armed"].Schedule != nil {
+		t.Errorf("Only home_armed trigger should have a schedule.")
+	}
+	garageSensor, garageFound := config.Sensors["Garage"]
+	if !garageFound {
+		t.Fatalf("Garage sensor should be declared using its name field.")
+	}
+	if garageSensor.Device != "2" {
+		t.Errorf("Garage Device should be '2'. Returned: %s.", garageSensor.Device)
+	}
+	if garageSensor.Topic != "esphome/garage/binary_sensor/door/state" {
+		t.Errorf("Garage Topic should be overriden. Returned: %s.", garageSensor.Topic)
+	}
+	if garageSensor.Debounce.Duration != 300*time.Millisecond || garageSensor.Debounce.OccupancyCount != 0 {
+		t.Errorf("Garage debounce should be 300ms. Returned: %+v.", garageSensor.Debounce)
+	}
+	if garageSensor.MaxOpenDuration != 10*time.Minute || garageSensor.OpenReminder != 30*time.Minute {
+		t.Errorf("Garage left open alerts should be 10m with 30m reminders. Returned: %s, %s.", garageSensor.MaxOpenDuration, garageSensor.OpenReminder)
+	}
+	if config.SensorTriggers["armed"].Sensors["Garage"] != garageSensor {
+		t.Errorf("Garage sensor should be included in armed trigger.")
+	}
+	if doorSensor.Zone != ZoneIntrusion || doorSensor.AlarmMode != "" {
+		t.Errorf("door1 should be an intrusion zone. Returned: %s, %s.", doorSensor.Zone, doorSensor.AlarmMode)
+	}
+	if leakSensor := config.Sensors["kitchen_leak"]; leakSensor.Zone != ZoneLifeSafety || leakSensor.AlarmMode != "WATER" {
+		t.Errorf("kitchen_leak should be a 24h zone setting WATER mode. Returned: %s, %s.", leakSensor.Zone, leakSensor.AlarmMode)
+	}
+	if smokeSensor := config.Sensors["hall_smoke"]; smokeSensor.Zone != ZoneLifeSafety || smokeSensor.AlarmMode != "FIRE" {
+		t.Errorf("hall_smoke should be a 24h zone setting FIRE mode. Returned: %s, %s.", smokeSensor.Zone, smokeSensor.AlarmMode)
+	}
+	if buttonSensor := config.Sensors["bedside_button"]; len(buttonSensor.Actions) != 4 || buttonSensor.Actions["hold"] != ActionPanic || buttonSensor.Actions["double"] != ActionDisarm {
+		t.Errorf("bedside_button should map 4 actions. Returned: %v.", buttonSensor.Actions)
+	}
+	if config.Actions.ArmHomeMode != "home_armed" || config.Actions.DisarmMode != "disarmed" || config.Actions.ConfirmWindow != 5*time.Second {
+		t.Errorf("Unexpected actions config %+v.", config.Actions)
+	}
+	if config.DryRun != true {
+		t.Errorf("DryRun should be enabled.")
+	}
+	if config.AlarmManager.PollInterval != 10*time.Second || config.AlarmManager.FailSafe != "armed" || config.AlarmManager.FailSafeMode != "armed" {
+		t.Errorf("Unexpected alarmManager tracking config %+v.", config.AlarmManager)
+	}
+	if config.Log.Level != "debug" || config.Log.Output != "json" {
+		t.Errorf("Log should be debug level json output. Returned: %s, %s.", config.Log.Level, config.Log.Output)
+	}
+	if config.Zigbee2mqtt.BaseTopic != "zigbee2mqtt" {
+		t.Errorf("Zigbee2mqtt BaseTopic should be 'zigbee2mqtt'. Returned: %s.", config.Zigbee2mqtt.BaseTopic)
+	}
+	if config.Rabbitmq.MaxPriority != 10 {
+		t.Errorf("Rabbitmq MaxPriority should be 10. Returned: %d.", config.Rabbitmq.MaxPriority)
+	}
+	if config.Sensors["motion1"].FriendlyName != "motion1" {
+		t.Errorf("motion1 FriendlyName should default to its name. Returned: %s.", config.Sensors["motion1"].FriendlyName)
+	}
+	if config.Fallback.Retries != 5 || config.Fallback.Backoff != 500*time.Millisecond {
+		t.Errorf("Fallback should retry 5 times every 500ms. Returned: %d, %s.", config.Fallback.Retries, config.Fallback.Backoff)
+	}
+	if config.Flapping.MaxTransitions != 6 || config.Flapping.Window != 2*time.Minute || config.Flapping.StableAfter != 5*time.Minute || !config.Flapping.Bypass {
+		t.Errorf("Unexpected flapping config %+v.", config.Flapping)
+	}
+	if config.API.Listen != "127.0.0.1:8080" || config.API.Token != "api-token" {
+		t.Errorf("Unexpected api config %+v.", config.API)
+	}
+	if config.Bypass.CommandTopic != "alarmsensors/bypass/set" {
+		t.Errorf("Bypass CommandTopic should be alarmsensors/bypass/set. Returned: %s.", config.Bypass.CommandTopic)
+	}
+	if config.Readiness.Policy != "refuse" {
+		t.Errorf("Readiness policy should be refuse. Returned: %s.", config.Readiness.Policy)
+	}
+	if len(config.Rules) != 1 || config.Rules[0].Name != "garage_open_at_night" || config.Rules[0].Device != "1" || !config.Rules[0].HighPriority || config.Rules[0].Cooldown != 30*time.Minute {
+		t.Errorf("Unexpected rules %+v.", config.Rules)
+	}
+	if config.RuleEngine.History != 2*time.Hour {
+		t.Errorf("Rule engine history should be 2h. Returned: %s.", config.RuleEngine.History)
+	}
+	if config.Fallback.SirenTopic != "zigbee2mqtt/siren/set" || config.Fallback.WebhookURL != "https://alerts.example.com/alarm" {
+		t.Errorf("Unexpected fallback channels %+v.", config.Fallback)
+	}
+}
+
+func TestSensorsConfigInvalidType(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_sensors_invalid_type/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with invalid sensor type should fail.")
+	} else {
+		if err.Error() != "Fatal error config: sensor door1 has invalid type thermostat." {
+			t.Errorf("Error should be \"Fatal error config: sensor door1 has invalid type thermostat.\" but error was '%s'.", err.Error())
+		}
+	}
+}
+
+func TestSensorsConfigCaseCollision(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_sensors_case_invalid/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with sensor names differing only by case should fail.")
+	} else {
+		if err.Error() != "Fatal error config: sensors Door1 and door1 differ only by case, declare name field in sensors table." {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestTopicPatternsConfig(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_topic_patterns/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig with topic patterns shouln't return errors. Returned: %s.", err.Error())
+	}
+	if len(config.Mqtt.TopicPatterns) != 2 {
+		t.Errorf("TopicPatterns length should be 2. Returned: %d.", len(config.Mqtt.TopicPatterns))
+	}
+	if len(config.Mqtt.Subscriptions) != 2 {
+		t.Errorf("Subscriptions length should be 2. Returned: %d.", len(config.Mqtt.Subscriptions))
+	}
+}
+
+func TestTopicPatternWithoutSensorCapture(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_topic_pattern_no_sensor/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with topic pattern without sensor capture should fail.")
+	} else {
+		if err.Error() != "Fatal error config: mqtt topic pattern esphome/{node}/binary_sensor/+/state has no {sensor} capture." {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestInvalidSubscription(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_invalid_subscription/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with invalid subscription should fail.")
+	} else {
+		if err.Error() != "Fatal error config: invalid mqtt subscription: Topic filter zigbee2mqtt/++ has misplaced '+', it must fill a whole level." {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestMqttSessionConfig(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_mqtt_session/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig with mqtt session config shouln't return errors. Returned: %s.", err.Error())
+	}
+	if config.Mqtt.ClientID != "alarmsensors" || config.Mqtt.ClientIDSuffix != "hostname" {
+		t.Errorf("Mqtt client id should be alarmsensors with hostname suffix. Returned: %s, %s.", config.Mqtt.ClientID, config.Mqtt.ClientIDSuffix)
+	}
+	if config.Mqtt.CleanSession != false || config.Mqtt.QoS != 2 {
+		t.Errorf("Mqtt session should be persistent with qos 2. Returned: %t, %d.", config.Mqtt.CleanSession, config.Mqtt.QoS)
+	}
+}
+
+func TestMqttPersistentSessionRandomClientID(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_mqtt_session_random/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with persistent session and random client id should fail.")
+	} else {
+		if err.Error() != "Fatal error config: mqtt persistent sessions require a stable client_id, random suffix is not allowed." {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestReadConfigFromLocation(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_no_mqtt/")
+	config, err := ReadConfigFrom("./config_files_test/config_ok/")
+	if err != nil {
+		t.Errorf("ReadConfigFrom with ok config location shouln't return errors. Returned: %s.", err.Error())
+	}
+	if config.Mqtt.Host != "localhost" {
+		t.Errorf("Mqtt Host should be localhost. Returned: %s.", config.Mqtt.Host)
+	}
+}
+
+func TestWebhooksConfig(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_webhooks/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig with webhooks config shouln't return errors. Returned: %s.", err.Error())
+	}
+	if len(config.Webhooks) != 2 {
+		t.Fatalf("Webhooks length should be 2. Returned: %d.", len(config.Webhooks))
+	}
+	ntfy := config.Webhooks["ntfy"]
+	if ntfy.ContentType != "text/plain" || len(ntfy.Events) != 2 || ntfy.Headers["priority"] != "urgent" {
+		t.Errorf("Unexpected ntfy webhook config %+v.", ntfy)
+	}
+	receiver := config.Webhooks["receiver"]
+	if receiver.Secret != "hmac-secret" || receiver.Retries != 5 || receiver.Backoff != time.Second || receiver.Timeout != 5*time.Second {
+		t.Errorf("Unexpected receiver webhook config %+v.", receiver)
+	}
+	if len(config.Notifications.Sinks) != 3 || config.Notifications.QueueSize != 20 || config.Notifications.MqttTopic != "home/alarm/events" {
+		t.Errorf("Unexpected notifications config %+v.", config.Notifications)
+	}
+	if config.RateLimit.Window != 10*time.Minute || config.RateLimit.MaxEvents != 6 || config.RateLimit.DedupWindow != 30*time.Second {
+		t.Errorf("Unexpected rate limit config %+v.", config.RateLimit)
+	}
+}
+
+func TestWebhookUnknownEvent(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_webhook_unknown_event/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with unknown webhook event should fail.")
+	} else {
+		if err.Error() != "Fatal error config: webhook discord has unknown event door_opened." {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestNotificationsInvalidSink(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_notifications_invalid_sink/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with invalid notifications sink should fail.")
+	} else {
+		if err.Error() != "Fatal error config: invalid notifications sink telegram, it must be rabbitmq, webhooks, mqtt or log." {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestScheduleInvalidWindow(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_schedule_invalid/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with invalid schedule should fail.")
+	} else {
+		if err.Error() != `Fatal error config: sensor garden has invalid schedule: invalid schedule window "Mon-Fri 25:00-06:00": time "25:00" must be HH:MM.` {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestRulesInvalidExpression(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_rules_invalid/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with invalid rule should fail.")
+	} else {
+		if !strings.HasPrefix(err.Error(), "Fatal error config: rule too_hot has invalid when expression: unknown name temperature") {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestReadinessInvalidPolicy(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_readiness_invalid/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with invalid readiness policy should fail.")
+	} else {
+		if err.Error() != "Fatal error config: readiness policy must be notify, bypass, refuse or none." {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestMessagesConfig(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_messages/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig with messages config shouln't return errors. Returned: %s.", err.Error())
+	}
+	if config.Messages.Locale != "es" {
+		t.Errorf("Messages locale should be es. Returned: %s.", config.Messages.Locale)
+	}
+	if len(config.Messages.Templates) != 2 || config.Messages.Templates["sensor_status.opened"] != "Se ha abierto {{.Sensor}}." {
+		t.Errorf("Unexpected message templates %v.", config.Messages.Templates)
+	}
+}
+
+func TestMessagesInvalidTemplate(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_messages_invalid/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with invalid message template should fail.")
+	} else if !strings.HasPrefix(err.Error(), "Fatal error config: invalid messages: ") {
+		t.Errorf("Unexpected error: '%s'.", err.Error())
+	}
+}
+
+func TestLifeSafetyConfigInvalid(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_life_safety_invalid/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with 24h sensor declared in alarm modes should fail.")
+	} else {
+		if err.Error() != "Fatal error config: sensor smoke1 is a 24h zone, it cannot be declared in alarm modes." {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestActionsConfigInvalid(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_actions_invalid/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with invalid action command should fail.")
+	} else {
+		if err.Error() != "Fatal error config: sensor button1 action single has invalid command open_garage, it must be panic, arm_home, disarm or duress." {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+}
+
+func TestAPIConfigWithoutToken(t *testing.T) {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_files_test/config_api_invalid/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig with api listening on every interface without token should fail.")
+	} else {
+		if err.Error() != "Fatal error config: api token is required when api listen is not a loopback address." {
+			t.Errorf("Unexpected error: '%s'.", err.Error())
+		}
+	}
+	for _, host := range []string{"127.0.0.1", "localhost", "::1"} {
+		if !loopbackHost(host) {
+			t.Errorf("%s should be a loopback host.", host)
+		}
+	}
+	for _, host := range []string{"", "0.0.0.0", "192.168.1.10", "alarm.local"} {
+		if loopbackHost(host) {
+			t.Errorf("'%s' should not be a loopback host.", host)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	alarmmanager "github.com/a-castellano/AlarmSensors/alarmmanager"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+var webhookClient = &http.Client{
+	Timeout: time.Second * 5, // Maximum of 5 secs
+}
+
+// sosFailureEvent is the webhook body sent when SOS could not be triggered
+type sosFailureEvent struct {
+	Event string `json:"event"`
+	storage.SOSFailure
+}
+
+// triggerSOS sets device in SOS mode retrying with backoff, failures are recorded and escalated through fallback channels
+func (s service) triggerSOS(ctx context.Context, sensorLog *slog.Logger, sensorName string, deviceID string, alarmMode string) {
+	s.triggerAlarmMode(ctx, sensorLog, sensorName, deviceID, alarmMode, alarmmanager.SOSMode)
+}
+
+// triggerAlarmMode sets device in targetMode the same way SOS is set, alarmMode is device mode when sensor was triggered
+func (s service) triggerAlarmMode(ctx context.Context, sensorLog *slog.Logger, sensorName string, deviceID string, alarmMode string, targetMode string) {
+	backoff := s.config.Fallback.Backoff
+	sosErr := s.alarm.SetMode(deviceID, targetMode)
+retries:
+	for attempt := 1; sosErr != nil && attempt <= s.config.Fallback.Retries; attempt++ {
+		sensorLog.Warn("Failed to trigger alarm, retrying.", "target_mode", targetMode, "attempt", attempt, "backoff", backoff, "error", sosErr)
+		select {
+		case <-ctx.Done():
+			break retries
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		sosErr = s.alarm.SetMode(deviceID, targetMode)
+	}
+	if sosErr == nil {
+		return
+	}
+
+	sensorLog.Error("Failed to trigger alarm, escalating through fallback channels.", "target_mode", targetMode, "retries", s.config.Fallback.Retries, "error", sosErr)
+	failure := storage.SOSFailure{Sensor: sensorName, Device: deviceID, Mode: alarmMode, Target: targetMode, Error: sosErr.Error(), Time: time.Now().Unix()}
+	if recordErr := s.storage.RecordSOSFailure(ctx, failure); recordErr != nil {
+		sensorLog.Error("Failed to record SOS failure.", "error", recordErr)
+	}
+	s.escalate(sensorLog, failure)
+}
+
+// escalate alerts about a failed SOS through every configured channel, an intrusion must never be silently lost
+func (s service) escalate(sensorLog *slog.Logger, failure storage.SOSFailure) {
+	delivered := 0
+
+	alertMessage := s.message(notifier.MessageSOSFailed, notifier.MessageData{SensorID: failure.Sensor, Device: failure.Device, Mode: failure.Mode, Error: failure.Error})
+	priority := highPriority
+	if failure.Target != alarmmanager.SOSMode {
+		alertMessage = s.message(notifier.MessageLifeSafetyFailed, notifier.MessageData{SensorID: failure.Sensor, Device: failure.Device, Mode: failure.Target, Error: failure.Error})
+		priority = criticalPriority
+	}
+	// Dispatcher only queues events, RabbitMQ alert is sent right away so it is only counted once it is delivered
+	if s.queueFunc != nil {
+		if queueErr := s.queueFunc(alertMessage, priority); queueErr != nil {
+			sensorLog.Error("Failed to send fallback message.", "error", queueErr)
+		} else {
+			delivered++
+		}
+	}
+	if sendErr := s.sendFunc(notifier.Event{Type: notifier.EventSOSFailed, Message: alertMessage, Priority: priority, Sensor: failure.Sensor, Device: failure.Device, Mode: failure.Mode, Time: time.Unix(failure.Time, 0)}); sendErr != nil {
+		sensorLog.Error("Failed to dispatch fallback message.", "error", sendErr)
+	}
+
+	if s.config.Fallback.SirenTopic != "" && s.publishFunc != nil {
+		if publishErr := s.publishFunc(s.config.Fallback.SirenTopic, s.config.Fallback.SirenPayload); publishErr != nil {
+			sensorLog.Error("Failed to publish siren payload.", "siren_topic", s.config.Fallback.SirenTopic, "error", publishErr)
+		} else {
+			delivered++
+		}
+	}
+
+	if s.config.Fallback.WebhookURL != "" {
+		if webhookErr := postSOSFailure(s.config.Fallback.WebhookURL, failure); webhookErr != nil {
+			sensorLog.Error("Failed to call fallback webhook.", "error", webhookErr)
+		} else {
+			delivered++
+		}
+	}
+
+	if delivered == 0 {
+		sensorLog.Error("SOS failure could not be escalated through any channel.")
+	}
+}
+
+func postSOSFailure(webhookURL string, failure storage.SOSFailure) error {
+	body, _ := json.Marshal(sosFailureEvent{Event: "sos_failed", SOSFailure: failure})
+	response, postErr := webhookClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if postErr != nil {
+		return postErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+// failingController never reaches alarmManager
+type failingController struct {
+	setModeCalls int
+}
+
+func (controller *failingController) CurrentMode(deviceID string) (string, error) {
+	return "armed", nil
+}
+
+func (controller *failingController) SetMode(deviceID string, mode string) error {
+	controller.setModeCalls++
+	return errors.New("connection refused")
+}
+
+func TestTriggerSOSEscalatesFailure(t *testing.T) {
+	var webhookEvent map[string]interface{}
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&webhookEvent)
+	}))
+	defer webhook.Close()
+
+	serviceConfig := readTestConfig(t)
+	serviceConfig.Fallback.Backoff = time.Millisecond
+	serviceConfig.Fallback.SirenTopic = "zigbee2mqtt/siren/set"
+	serviceConfig.Fallback.WebhookURL = webhook.URL
+
+	messages, _ := notifier.NewCatalog(serviceConfig.Messages.Locale, nil)
+	controller := &failingController{}
+	memoryStorage := storage.NewMemoryStorage()
+	var highPriorityMessages []string
+	var queuedMessages []string
+	var sirenTopics []string
+	fallbackService := service{
+		config:  serviceConfig,
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		alarm:   controller,
+		storage: memoryStorage,
+		sendFunc: func(event notifier.Event) error {
+			if event.Priority == highPriority {
+				highPriorityMessages = append(highPriorityMessages, event.Message)
+			}
+			return nil
+		},
+		queueFunc: func(message string, priority uint8) error {
+			if priority == highPriority {
+				queuedMessages = append(queuedMessages, message)
+			}
+			return nil
+		},
+		publishFunc: func(topic string, payload string) error {
+			sirenTopics = append(sirenTopics, topic)
+			return nil
+		},
+		messages: messages,
+	}
+
+	fallbackService.triggerSOS(context.Background(), fallbackService.log, "door1", "1", "armed")
+
+	if controller.setModeCalls != 4 {
+		t.Errorf("SOS should be tried 4 times. Tried: %d.", controller.setModeCalls)
+	}
+	if len(memoryStorage.SOSFailures) != 1 || memoryStorage.SOSFailures[0].Sensor != "door1" {
+		t.Errorf("SOS failure should be recorded. Returned: %+v.", memoryStorage.SOSFailures)
+	}
+	if len(highPriorityMessages) != 1 {
+		t.Errorf("A high priority message should be sent. Returned: %v.", highPriorityMessages)
+	}
+	if len(queuedMessages) != 1 {
+		t.Errorf("A high priority message should be sent to RabbitMQ. Returned: %v.", queuedMessages)
+	}
+	if len(sirenTopics) != 1 || sirenTopics[0] != "zigbee2mqtt/siren/set" {
+		t.Errorf("Siren should be published. Returned: %v.", sirenTopics)
+	}
+	if webhookEvent["event"] != "sos_failed" || webhookEvent["device"] != "1" {
+		t.Errorf("Unexpected webhook event %v.", webhookEvent)
+	}
+}
+
+func TestEscalateRabbitMQFailure(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	messages, _ := notifier.NewCatalog(serviceConfig.Messages.Locale, nil)
+	var logOutput bytes.Buffer
+	dispatched := 0
+	fallbackService := service{
+		config:  serviceConfig,
+		log:     slog.New(slog.NewTextHandler(&logOutput, nil)),
+		storage: storage.NewMemoryStorage(),
+		sendFunc: func(event notifier.Event) error {
+			dispatched++
+			return nil
+		},
+		queueFunc: func(message string, priority uint8) error {
+			return errors.New("connection refused")
+		},
+		messages: messages,
+	}
+
+	fallbackService.escalate(fallbackService.log, storage.SOSFailure{Sensor: "door1", Device: "1", Mode: "armed", Target: "SOS", Error: "timeout", Time: time.Now().Unix()})
+
+	if dispatched != 1 {
+		t.Errorf("SOS failure should still be dispatched to sinks. Returned: %d.", dispatched)
+	}
+	if !strings.Contains(logOutput.String(), "SOS failure could not be escalated through any channel.") {
+		t.Errorf("Queued event should not count as delivered when RabbitMQ fails. Log: %s", logOutput.String())
+	}
+}
+
+func TestTriggerAlarmModeEscalatesLifeSafetyFailure(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	serviceConfig.Fallback.Retries = 0
+
+	messages, _ := notifier.NewCatalog(serviceConfig.Messages.Locale, nil)
+	memoryStorage := storage.NewMemoryStorage()
+	var events []notifier.Event
+	fallbackService := service{
+		config:  serviceConfig,
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		alarm:   &failingController{},
+		storage: memoryStorage,
+		sendFunc: func(event notifier.Event) error {
+			events = append(events, event)
+			return nil
+		},
+		messages: messages,
+	}
+
+	fallbackService.triggerAlarmMode(context.Background(), fallbackService.log, "door1", "1", "disarmed", "FIRE")
+
+	if len(memoryStorage.SOSFailures) != 1 || memoryStorage.SOSFailures[0].Target != "FIRE" || memoryStorage.SOSFailures[0].Mode != "disarmed" {
+		t.Errorf("FIRE failure should be recorded. Returned: %+v.", memoryStorage.SOSFailures)
+	}
+	if len(events) != 1 || events[0].Priority != criticalPriority || events[0].Message != "EMERGENCY - door1 sensor has been triggered but alarm status could not be set to FIRE on device 1: connection refused" {
+		t.Errorf("A critical priority message should be sent. Returned: %+v.", events)
+	}
+}
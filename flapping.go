@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	"golang.org/x/net/context"
+)
+
+const flappingCheckInterval time.Duration = 30 * time.Second
+
+// checkFlapping returns true while sensor is flapping, transition must be already recorded
+func (s service) checkFlapping(ctx context.Context, sensorLog *slog.Logger, sensorName string, now time.Time) bool {
+	flappingConfig := s.config.Flapping
+	if flappingConfig.MaxTransitions == 0 {
+		return false
+	}
+	transitions, countErr := s.storage.CountTransitions(ctx, sensorName, now.Add(-flappingConfig.Window))
+	if countErr != nil {
+		sensorLog.Error("Failed to count sensor transitions.", "error", countErr)
+		return false
+	}
+	if transitions > int64(flappingConfig.MaxTransitions) {
+		changed, flappingErr := s.storage.SetFlapping(ctx, sensorName, true)
+		if flappingErr != nil {
+			sensorLog.Error("Failed to flag sensor as flapping.", "error", flappingErr)
+		}
+		if changed {
+			messageKey := notifier.MessageSensorFlapping
+			priority := normalPriority
+			// Bypassed sensors leave a hole in protection
+			if flappingConfig.Bypass {
+				messageKey = notifier.MessageSensorFlappingBypass
+				priority = highPriority
+			}
+			flappingMessage := s.message(messageKey, notifier.MessageData{SensorID: sensorName, Count: transitions, Duration: shortDuration(flappingConfig.Window)})
+			sensorLog.Warn(flappingMessage, "transitions", transitions)
+			s.send(notifier.Event{Type: notifier.EventSensorTrouble, Message: flappingMessage, Priority: priority, Sensor: sensorName, Device: s.config.Sensors[sensorName].Device})
+		}
+		return true
+	}
+	// Flapping sensors remain flagged until they are stable
+	sensorStatus, _, statusErr := s.storage.GetSensorStatus(ctx, sensorName)
+	if statusErr != nil {
+		sensorLog.Error("Failed to read sensor status.", "error", statusErr)
+		return false
+	}
+	return sensorStatus.Flapping
+}
+
+// superviseFlapping clears flapping flag of sensors without transitions within stable_after
+func (s service) superviseFlapping(ctx context.Context) {
+	if s.config.Flapping.MaxTransitions == 0 {
+		return
+	}
+	ticker := time.NewTicker(flappingCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.clearStableSensors(ctx, time.Now())
+	}
+}
+
+func (s service) clearStableSensors(ctx context.Context, now time.Time) {
+	for sensorName, sensor := range s.config.Sensors {
+		sensorStatus, found, statusErr := s.storage.GetSensorStatus(ctx, sensorName)
+		if statusErr != nil {
+			s.log.Error("Failed to read sensor status.", "sensor", sensorName, "error", statusErr)
+			continue
+		}
+		if !found || !sensorStatus.Flapping {
+			continue
+		}
+		transitions, countErr := s.storage.CountTransitions(ctx, sensorName, now.Add(-s.config.Flapping.StableAfter))
+		if countErr != nil {
+			s.log.Error("Failed to count sensor transitions.", "sensor", sensorName, "error", countErr)
+			continue
+		}
+		if transitions > 0 {
+			continue
+		}
+		if changed, _ := s.storage.SetFlapping(ctx, sensorName, false); changed {
+			stableMessage := s.message(notifier.MessageSensorStable, notifier.MessageData{SensorID: sensorName})
+			s.log.Info(stableMessage, "sensor", sensorName)
+			s.send(notifier.Event{Type: notifier.EventSensorTrouble, Message: stableMessage, Priority: normalPriority, Sensor: sensorName, Device: sensor.Device})
+		}
+	}
+}
@@ -1,21 +1,23 @@
 module github.com/a-castellano/AlarmSensors
 
-go 1.20
+go 1.21
 
 require (
 	github.com/a-castellano/AlarmStatusWatcher v0.0.0-20220617163632-f44ad72651b9
 	github.com/eclipse/paho.mqtt.golang v1.4.3
+	github.com/expr-lang/expr v1.17.8
 	github.com/go-redis/redis/v8 v8.11.5
+	github.com/go-redis/redismock/v8 v8.11.5
 	github.com/spf13/viper v1.16.0
 	github.com/streadway/amqp v1.1.0
 	golang.org/x/net v0.12.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/fsnotify/fsnotify v1.6.0 // indirect
-	github.com/go-redis/redismock/v8 v8.11.5 // indirect
 	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/magiconair/properties v1.8.7 // indirect
@@ -30,5 +32,4 @@ require (
 	golang.org/x/sys v0.10.0 // indirect
 	golang.org/x/text v0.11.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+// openAlerts keeps one left open alert timer per sensor, it is safe for concurrent use
+type openAlerts struct {
+	mutex  sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newOpenAlerts() *openAlerts {
+	return &openAlerts{timers: make(map[string]*time.Timer)}
+}
+
+// schedule replaces sensor timer
+func (alerts *openAlerts) schedule(sensorName string, after time.Duration, alert func()) {
+	alerts.mutex.Lock()
+	defer alerts.mutex.Unlock()
+	if timer, scheduled := alerts.timers[sensorName]; scheduled {
+		timer.Stop()
+	}
+	alerts.timers[sensorName] = time.AfterFunc(after, alert)
+}
+
+func (alerts *openAlerts) cancel(sensorName string) {
+	alerts.mutex.Lock()
+	defer alerts.mutex.Unlock()
+	if timer, scheduled := alerts.timers[sensorName]; scheduled {
+		timer.Stop()
+		delete(alerts.timers, sensorName)
+	}
+}
+
+// openDuration rounds durations shown in left open messages
+func openDuration(duration time.Duration) string {
+	if duration < time.Minute {
+		return shortDuration(duration.Round(time.Second))
+	}
+	return shortDuration(duration.Round(time.Minute))
+}
+
+// trackOpenSensor schedules left open alert when sensor opens, a follow-up is sent when a sensor left open closes
+func (s service) trackOpenSensor(ctx context.Context, sensorLog *slog.Logger, sensorName string, opened bool, previousStatus storage.SensorStatus, now time.Time) {
+	sensor := s.config.Sensors[sensorName]
+	if opened {
+		// Alerts are bound to stored change time, they are discarded if sensor changes meanwhile
+		sensorStatus, _, statusErr := s.storage.GetSensorStatus(ctx, sensorName)
+		if statusErr != nil {
+			sensorLog.Error("Failed to read sensor status.", "error", statusErr)
+			return
+		}
+		s.scheduleOpenAlert(ctx, sensorName, time.Unix(sensorStatus.ChangedAt, 0), now)
+		return
+	}
+	if s.openAlerts != nil {
+		s.openAlerts.cancel(sensorName)
+	}
+	if !previousStatus.Activated || previousStatus.ChangedAt == 0 {
+		return
+	}
+	openFor := now.Sub(time.Unix(previousStatus.ChangedAt, 0))
+	if openFor < sensor.MaxOpenDuration {
+		return
+	}
+	closedMessage := s.message(notifier.MessageLeftOpenClosed, notifier.MessageData{SensorID: sensorName, Device: sensor.Device, Duration: openDuration(openFor)})
+	sensorLog.Info(closedMessage)
+	s.send(notifier.Event{Type: notifier.EventLeftOpen, Message: closedMessage, Priority: normalPriority, Sensor: sensorName, Device: sensor.Device})
+}
+
+// scheduleOpenAlert schedules next left open alert, reminders missed while service was stopped are skipped
+func (s service) scheduleOpenAlert(ctx context.Context, sensorName string, openedAt time.Time, now time.Time) {
+	if s.openAlerts == nil {
+		return
+	}
+	sensor := s.config.Sensors[sensorName]
+	due := openedAt.Add(sensor.MaxOpenDuration)
+	if !due.After(now) && sensor.OpenReminder > 0 {
+		missed := now.Sub(due)/sensor.OpenReminder + 1
+		due = due.Add(missed * sensor.OpenReminder)
+	}
+	s.openAlerts.schedule(sensorName, due.Sub(now), func() {
+		s.sendOpenAlert(ctx, sensorName, openedAt)
+	})
+}
+
+// sendOpenAlert notifies a sensor is still open, alerts of sensors closed or opened again meanwhile are discarded
+func (s service) sendOpenAlert(ctx context.Context, sensorName string, openedAt time.Time) {
+	sensor := s.config.Sensors[sensorName]
+	sensorStatus, found, statusErr := s.storage.GetSensorStatus(ctx, sensorName)
+	if statusErr != nil {
+		s.log.Error("Failed to read sensor status.", "sensor", sensorName, "error", statusErr)
+		return
+	}
+	if !found || !sensorStatus.Activated || sensorStatus.ChangedAt != openedAt.Unix() {
+		return
+	}
+	now := time.Now()
+	openMessage := s.message(notifier.MessageLeftOpen, notifier.MessageData{SensorID: sensorName, Device: sensor.Device, Duration: openDuration(now.Sub(openedAt))})
+	// Alerts are stored so they are not sent again after a restart
+	if storeErr := s.storage.SetOpenAlert(ctx, sensorName, now); storeErr != nil {
+		s.log.Error("Failed to store left open alert.", "sensor", sensorName, "error", storeErr)
+	}
+	s.log.Warn(openMessage, "sensor", sensorName)
+	s.send(notifier.Event{Type: notifier.EventLeftOpen, Message: openMessage, Priority: normalPriority, Sensor: sensorName, Device: sensor.Device})
+	if sensor.OpenReminder > 0 {
+		s.scheduleOpenAlert(ctx, sensorName, openedAt, now)
+	}
+}
+
+// restoreOpenAlerts rebuilds left open timers of sensors stored as open, alerts already sent without reminders are not restored
+func (s service) restoreOpenAlerts(ctx context.Context) {
+	now := time.Now()
+	for _, sensorName := range sortedSensorNames(s.config) {
+		sensor := s.config.Sensors[sensorName]
+		if sensor.MaxOpenDuration == 0 {
+			continue
+		}
+		sensorStatus, found, statusErr := s.storage.GetSensorStatus(ctx, sensorName)
+		if statusErr != nil {
+			s.log.Error("Failed to read sensor status.", "sensor", sensorName, "error", statusErr)
+			continue
+		}
+		if !found || !sensorStatus.Activated || sensorStatus.ChangedAt == 0 {
+			continue
+		}
+		if sensor.OpenReminder == 0 && sensorStatus.OpenAlertAt >= sensorStatus.ChangedAt {
+			continue
+		}
+		s.scheduleOpenAlert(ctx, sensorName, time.Unix(sensorStatus.ChangedAt, 0), now)
+	}
+}
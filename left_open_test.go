@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	alarmsensors "github.com/a-castellano/AlarmSensors/alarmsensors"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+func newLeftOpenTestService(t *testing.T, memoryStorage *storage.MemoryStorage, maxOpen time.Duration, reminder time.Duration) (service, chan string) {
+	serviceConfig := readTestConfig(t)
+	serviceConfig.Sensors["door1"].MaxOpenDuration = maxOpen
+	serviceConfig.Sensors["door1"].OpenReminder = reminder
+	messages, _ := notifier.NewCatalog(serviceConfig.Messages.Locale, nil)
+	sent := make(chan string, 10)
+	return service{
+		config:  serviceConfig,
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		alarm:   &simulatedController{out: io.Discard, mode: "disarmed"},
+		storage: memoryStorage,
+		sendFunc: func(event notifier.Event) error {
+			if event.Type == notifier.EventLeftOpen {
+				sent <- event.Message
+			}
+			return nil
+		},
+		messages:   messages,
+		openAlerts: newOpenAlerts(),
+	}, sent
+}
+
+func TestLeftOpenAlert(t *testing.T) {
+	leftOpenService, sent := newLeftOpenTestService(t, storage.NewMemoryStorage(), 50*time.Millisecond, 0)
+	ctx := context.Background()
+
+	leftOpenService.handleSensorValue(ctx, leftOpenService.log, "door1", alarmsensors.SensorValue{Kind: alarmsensors.KindContact, Value: false})
+	select {
+	case message := <-sent:
+		if !strings.HasPrefix(message, "door1 has been open for ") {
+			t.Errorf("Unexpected left open message %s.", message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Left open alert should be sent.")
+	}
+}
+
+func TestLeftOpenClosedFollowUp(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	leftOpenService, sent := newLeftOpenTestService(t, memoryStorage, 10*time.Minute, 0)
+	ctx := context.Background()
+	memoryStorage.UpdateAndNotify(ctx, "door1", false)
+	memoryStorage.SetActivated(ctx, "door1", alarmsensors.KindContact, true, time.Now().Add(-15*time.Minute))
+
+	leftOpenService.handleSensorValue(ctx, leftOpenService.log, "door1", alarmsensors.SensorValue{Kind: alarmsensors.KindContact, Value: true})
+	select {
+	case message := <-sent:
+		if message != "door1 has been closed after being open for 15m." {
+			t.Errorf("Unexpected follow-up message %s.", message)
+		}
+	default:
+		t.Error("Closed follow-up should be sent.")
+	}
+}
+
+func TestRestoreOpenAlerts(t *testing.T) {
+	memoryStorage := storage.NewMemoryStorage()
+	ctx := context.Background()
+	memoryStorage.UpdateAndNotify(ctx, "door1", false)
+	memoryStorage.SetActivated(ctx, "door1", alarmsensors.KindContact, true, time.Now().Add(-2*time.Hour))
+
+	// Overdue alert without reminders is sent at once
+	leftOpenService, sent := newLeftOpenTestService(t, memoryStorage, time.Hour, 0)
+	leftOpenService.restoreOpenAlerts(ctx)
+	select {
+	case message := <-sent:
+		if message != "door1 has been open for 2h." {
+			t.Errorf("Unexpected left open message %s.", message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Overdue left open alert should be sent.")
+	}
+
+	// Sent alert is not sent again on next restart
+	leftOpenService, sent = newLeftOpenTestService(t, memoryStorage, time.Hour, 0)
+	leftOpenService.restoreOpenAlerts(ctx)
+	if _, scheduled := leftOpenService.openAlerts.timers["door1"]; scheduled {
+		t.Error("Left open alert already sent should not be scheduled again.")
+	}
+
+	// Missed reminders are skipped, next one is scheduled
+	leftOpenService, sent = newLeftOpenTestService(t, memoryStorage, time.Hour, 30*time.Minute)
+	leftOpenService.restoreOpenAlerts(ctx)
+	select {
+	case message := <-sent:
+		t.Errorf("Missed reminders should not be sent. Returned: %s.", message)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, scheduled := leftOpenService.openAlerts.timers["door1"]; !scheduled {
+		t.Error("Next reminder should be scheduled.")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log/slog"
+
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	"golang.org/x/net/context"
+)
+
+// alarmIsLifeSafety returns true if alarmMode is set by 24h sensors
+func alarmIsLifeSafety(serviceConfig config.Config, alarmMode string) bool {
+	for _, sensor := range serviceConfig.Sensors {
+		if sensor.Zone == config.ZoneLifeSafety && sensor.AlarmMode == alarmMode {
+			return true
+		}
+	}
+	return false
+}
+
+// triggerLifeSafety sets 24h sensor alarm mode whatever alarm mode is, schedules, bypasses and flapping never apply to 24h sensors
+func (s service) triggerLifeSafety(ctx context.Context, sensorLog *slog.Logger, sensorName string, sensorState string) {
+	sensor := s.config.Sensors[sensorName]
+	// Current mode is only informative, an unknown alarm status never stops a life-safety alarm
+	currentAlarmMode, modeErr := s.alarm.CurrentMode(sensor.Device)
+	if modeErr != nil {
+		sensorLog.Error("Failed to read alarm status, triggering life-safety alarm anyway.", "error", modeErr)
+	}
+	sensorLog = sensorLog.With("mode", currentAlarmMode, "target_mode", sensor.AlarmMode)
+	logMessage := s.message("life_safety."+sensorState, notifier.MessageData{SensorID: sensorName, Device: sensor.Device, Mode: sensor.AlarmMode, PreviousMode: currentAlarmMode})
+	sensorLog.Error(logMessage)
+	s.send(notifier.Event{Type: notifier.EventLifeSafety, Message: logMessage, Priority: criticalPriority, Sensor: sensorName, Device: sensor.Device, Mode: sensor.AlarmMode})
+	s.triggerAlarmMode(ctx, sensorLog, sensorName, sensor.Device, currentAlarmMode, sensor.AlarmMode)
+}
@@ -0,0 +1,159 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	OutputJournald string = "journald"
+	OutputJSON     string = "json"
+	OutputText     string = "text"
+	OutputSyslog   string = "syslog"
+)
+
+const syslogTag string = "windmaker-alarmsensors"
+
+func ParseLevel(level string) (slog.Level, error) {
+	var parsedLevel slog.Level
+	switch strings.ToLower(level) {
+	case "", "info":
+		parsedLevel = slog.LevelInfo
+	case "debug":
+		parsedLevel = slog.LevelDebug
+	case "warn", "warning":
+		parsedLevel = slog.LevelWarn
+	case "error":
+		parsedLevel = slog.LevelError
+	default:
+		return parsedLevel, errors.New("Unknown log level " + level + ".")
+	}
+	return parsedLevel, nil
+}
+
+func ValidOutput(output string) bool {
+	switch output {
+	case "", OutputJournald, OutputJSON, OutputText, OutputSyslog:
+		return true
+	}
+	return false
+}
+
+// DefaultOutput is journald when stderr is connected to journal, text otherwise
+func DefaultOutput() string {
+	if os.Getenv("JOURNAL_STREAM") != "" {
+		return OutputJournald
+	}
+	return OutputText
+}
+
+// New creates a logger writing to out, syslog output ignores it
+func New(output string, level string, out io.Writer) (*slog.Logger, error) {
+	parsedLevel, levelErr := ParseLevel(level)
+	if levelErr != nil {
+		return nil, levelErr
+	}
+	if output == "" {
+		output = DefaultOutput()
+	}
+	options := &slog.HandlerOptions{Level: parsedLevel}
+	switch output {
+	case OutputJSON:
+		return slog.New(slog.NewJSONHandler(out, options)), nil
+	case OutputText:
+		return slog.New(slog.NewTextHandler(out, options)), nil
+	case OutputJournald:
+		// Journal already timestamps entries and reads priority from line prefix
+		options.ReplaceAttr = dropTime
+		writer := &levelWriter{write: func(level slog.Level, line []byte) error {
+			_, err := fmt.Fprintf(out, "<%d>%s", journaldPriority(level), line)
+			return err
+		}}
+		return slog.New(levelHandler{inner: slog.NewTextHandler(writer, options), writer: writer}), nil
+	case OutputSyslog:
+		syslogWriter, syslogErr := syslog.New(syslog.LOG_INFO, syslogTag)
+		if syslogErr != nil {
+			return nil, syslogErr
+		}
+		options.ReplaceAttr = dropTime
+		writer := &levelWriter{write: func(level slog.Level, line []byte) error {
+			return writeSyslog(syslogWriter, level, strings.TrimSuffix(string(line), "\n"))
+		}}
+		return slog.New(levelHandler{inner: slog.NewTextHandler(writer, options), writer: writer}), nil
+	}
+	return nil, errors.New("Unknown log output " + output + ".")
+}
+
+func dropTime(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key == slog.TimeKey && len(groups) == 0 {
+		return slog.Attr{}
+	}
+	return attr
+}
+
+// journaldPriority maps levels to sd-daemon priorities
+func journaldPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	}
+	return 7
+}
+
+func writeSyslog(syslogWriter *syslog.Writer, level slog.Level, message string) error {
+	switch {
+	case level >= slog.LevelError:
+		return syslogWriter.Err(message)
+	case level >= slog.LevelWarn:
+		return syslogWriter.Warning(message)
+	case level >= slog.LevelInfo:
+		return syslogWriter.Info(message)
+	}
+	return syslogWriter.Debug(message)
+}
+
+// levelWriter receives formatted lines along with the level of the record being handled
+type levelWriter struct {
+	mutex sync.Mutex
+	level slog.Level
+	write func(level slog.Level, line []byte) error
+}
+
+func (writer *levelWriter) Write(line []byte) (int, error) {
+	return len(line), writer.write(writer.level, line)
+}
+
+type levelHandler struct {
+	inner  slog.Handler
+	writer *levelWriter
+}
+
+func (handler levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return handler.inner.Enabled(ctx, level)
+}
+
+func (handler levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler.writer.mutex.Lock()
+	defer handler.writer.mutex.Unlock()
+	handler.writer.level = record.Level
+	return handler.inner.Handle(ctx, record)
+}
+
+func (handler levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{inner: handler.inner.WithAttrs(attrs), writer: handler.writer}
+}
+
+func (handler levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{inner: handler.inner.WithGroup(name), writer: handler.writer}
+}
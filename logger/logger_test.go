@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("ParseLevel should fail with unknown level.")
+	}
+	level, err := ParseLevel("DEBUG")
+	if err != nil || level.String() != "DEBUG" {
+		t.Errorf("ParseLevel should parse debug level. Returned: %s.", level)
+	}
+}
+
+func TestJournaldOutput(t *testing.T) {
+	var out bytes.Buffer
+	log, err := New(OutputJournald, "debug", &out)
+	if err != nil {
+		t.Fatalf("New should not fail, error was %s", err.Error())
+	}
+	log.With("sensor", "door1").Error("Sensor is offline.")
+	log.Debug("Sensor status.", "topic", "zigbee2mqtt/door1")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("There should be 2 lines. Output:\n%s", out.String())
+	}
+	if lines[0] != `<3>level=ERROR msg="Sensor is offline." sensor=door1` {
+		t.Errorf("Unexpected error line %s.", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "<7>level=DEBUG") {
+		t.Errorf("Unexpected debug line %s.", lines[1])
+	}
+}
+
+func TestJSONOutputLevel(t *testing.T) {
+	var out bytes.Buffer
+	log, err := New(OutputJSON, "warn", &out)
+	if err != nil {
+		t.Fatalf("New should not fail, error was %s", err.Error())
+	}
+	log.Info("Ignored.")
+	log.Warn("Kept.", "mode", "armed")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("Output should be a single JSON record. Output:\n%s", out.String())
+	}
+	if record["msg"] != "Kept." || record["mode"] != "armed" {
+		t.Errorf("Unexpected record %v.", record)
+	}
+}
+
+func TestUnknownOutput(t *testing.T) {
+	if _, err := New("file", "info", &bytes.Buffer{}); err == nil {
+		t.Errorf("New should fail with unknown output.")
+	}
+}
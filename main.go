@@ -1,57 +1,53 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"log/syslog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	alarmmanager "github.com/a-castellano/AlarmSensors/alarmmanager"
 	alarmsensors "github.com/a-castellano/AlarmSensors/alarmsensors"
 	config "github.com/a-castellano/AlarmSensors/config_reader"
+	logger "github.com/a-castellano/AlarmSensors/logger"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
 	storage "github.com/a-castellano/AlarmSensors/storage"
-	apiwatcher "github.com/a-castellano/AlarmStatusWatcher/apiwatcher"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	goredis "github.com/go-redis/redis/v8"
 	"github.com/streadway/amqp"
 	"golang.org/x/net/context"
 )
 
-var messagePubHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
-	fmt.Printf("Received message: %s from topic: %s\n", msg.Payload(), msg.Topic())
-}
-
-var connectHandler mqtt.OnConnectHandler = func(client mqtt.Client) {
-	fmt.Println("Connected")
-}
-
-var connectLostHandler mqtt.ConnectionLostHandler = func(client mqtt.Client, err error) {
-	fmt.Printf("Connect lost: %v", err)
-}
+const (
+	normalPriority uint8 = 0
+	highPriority   uint8 = notifier.HighPriority
+	// criticalPriority is used by life-safety alarms, above intrusion alarms
+	criticalPriority uint8 = 10
+)
 
-func sub(client mqtt.Client, topicFromConfig string, syslog *syslog.Writer) {
-	topic := fmt.Sprintf("%s+", topicFromConfig)
-	token := client.Subscribe(topic, 1, nil)
-	token.Wait()
-	syslog.Info(fmt.Sprintf("Subscribed to topic: %s", topic))
-}
+// notificationsDrainTimeout limits how long queued notifications are delivered on shutdown
+const notificationsDrainTimeout time.Duration = 30 * time.Second
 
-func sendMessageByQueue(rabbitmqConfig config.Rabbitmq, messageToSend string) error {
+func sendMessageByQueue(rabbitmqConfig config.Rabbitmq, messageToSend string, priority uint8) error {
 
 	dialString := fmt.Sprintf("amqp://%s:%s@%s:%d/", rabbitmqConfig.User, rabbitmqConfig.Password, rabbitmqConfig.Host, rabbitmqConfig.Port)
 	conn, errDial := amqp.Dial(dialString)
-	defer conn.Close()
-
 	if errDial != nil {
-		fmt.Println(errDial)
 		return errDial
 	}
+	defer conn.Close()
 
 	channel, errChannel := conn.Channel()
-	defer channel.Close()
 	if errChannel != nil {
 		return errChannel
 	}
+	defer channel.Close()
+
+	var queueArguments amqp.Table
+	if rabbitmqConfig.MaxPriority > 0 {
+		queueArguments = amqp.Table{"x-max-priority": int32(rabbitmqConfig.MaxPriority)}
+	}
 
 	queue, errQueue := channel.QueueDeclare(
 		rabbitmqConfig.Queue, // name
@@ -59,7 +55,7 @@ func sendMessageByQueue(rabbitmqConfig config.Rabbitmq, messageToSend string) er
 		false,                // delete when unused
 		false,                // exclusive
 		false,                // no-wait
-		nil,                  // arguments
+		queueArguments,       // arguments
 	)
 	if errQueue != nil {
 		return errQueue
@@ -74,6 +70,7 @@ func sendMessageByQueue(rabbitmqConfig config.Rabbitmq, messageToSend string) er
 		false,
 		amqp.Publishing{
 			DeliveryMode: amqp.Persistent,
+			Priority:     priority,
 			ContentType:  "text/plain",
 			Body:         []byte(messageToSend),
 		})
@@ -85,128 +82,210 @@ func sendMessageByQueue(rabbitmqConfig config.Rabbitmq, messageToSend string) er
 
 }
 
-func handleMessage(ctx context.Context, serviceConfig config.Config, syslog *syslog.Writer, watcher apiwatcher.APIWatcher, alarmManagerRequester apiwatcher.Requester, topic string, message string, storageInstance storage.Storage) {
-
-	candidateSensor := alarmsensors.RetriveChildTopic(topic, serviceConfig.Mqtt.WildcardTopic)
-
-	if _, sensorIsManaged := serviceConfig.Sensors[candidateSensor]; sensorIsManaged {
-		changed, statusMessage, sensorActivated, checkSensorErr := alarmsensors.CheckSensorTriggered(ctx, candidateSensor, message, storageInstance)
-		if checkSensorErr != nil {
-			errorString := fmt.Sprintf("%v", checkSensorErr.Error())
-			syslog.Err(errorString)
-		} else {
-			syslog.Info(statusMessage)
-			// Check alarm status
-			if changed == true {
-				if sensorActivated == true {
-					apiInfo, apiInfoErr := watcher.ShowInfo(alarmManagerRequester)
-					if apiInfoErr != nil {
-						apiErrorString := fmt.Sprintf("%v", apiInfoErr.Error())
-						syslog.Err(apiErrorString)
-					} else {
-						currentAlarmMode := apiInfo.DevicesInfo[serviceConfig.AlarmManager.DeviceId].Mode
-						// Check if sensor triggers alarm
-						if _, triggerAlarm := serviceConfig.Sensors[candidateSensor].SensorTriggers[currentAlarmMode]; triggerAlarm {
-							logMessage := fmt.Sprintf("%s sensor has been triggered and alarm status is %s, triggering alarm.", candidateSensor, currentAlarmMode)
-							syslog.Info(logMessage)
-							sendMessageByQueue(serviceConfig.Rabbitmq, logMessage)
-							jsonString := fmt.Sprintf("{\"mode\":\"SOS\"}")
-							var jsonStr = []byte(jsonString)
-							apiURL := fmt.Sprintf("http://%s:%d/devices/status/%s", serviceConfig.AlarmManager.Host, serviceConfig.AlarmManager.Port, serviceConfig.AlarmManager.DeviceId)
-							req, _ := http.NewRequest("PUT", apiURL, bytes.NewBuffer(jsonStr))
-							req.Header.Set("Content-Type", "application/json")
-							client := &http.Client{}
-							client.Do(req)
-						} else {
-							logMessage := fmt.Sprintf("DEBUG - %s sensor has been triggered but alarm status is %s, NOT triggering alarm.", candidateSensor, currentAlarmMode)
-							syslog.Info(logMessage)
-							sendMessageByQueue(serviceConfig.Rabbitmq, logMessage)
-						}
-					}
-				} else {
-					debugMessage := fmt.Sprintf("DEBUG - %s", statusMessage)
-					syslog.Info(debugMessage)
-					sendMessageByQueue(serviceConfig.Rabbitmq, debugMessage)
-				}
-			}
-		}
-	}
+func newRedisClient(serviceConfig config.Config) *goredis.Client {
+	redisAddress := fmt.Sprintf("%s:%d", serviceConfig.RedisServer.IP, serviceConfig.RedisServer.Port)
+	return goredis.NewClient(&goredis.Options{
+		Addr:     redisAddress,
+		Password: serviceConfig.RedisServer.Password,
+		DB:       serviceConfig.RedisServer.Database,
+	})
 }
 
-func main() {
+func newRedisStorage(ctx context.Context, serviceConfig config.Config) (storage.Storage, error) {
+	redisClient := newRedisClient(serviceConfig)
+	redisErr := redisClient.Set(ctx, "checkKey", "key", 1000000).Err()
+	return storage.Storage{RedisClient: redisClient}, redisErr
+}
 
-	syslog, err := syslog.New(syslog.LOG_INFO, "windmaker-alarmsensors")
-	if err != nil {
-		panic(err)
+// newReadOnlyRedisStorage only pings Redis, inspection commands never write to it
+func newReadOnlyRedisStorage(ctx context.Context, serviceConfig config.Config) (storage.Storage, error) {
+	redisClient := newRedisClient(serviceConfig)
+	redisErr := redisClient.Ping(ctx).Err()
+	return storage.Storage{RedisClient: redisClient}, redisErr
+}
+
+// alarmDevices returns every alarmManager device used by sensors
+func alarmDevices(serviceConfig config.Config) []string {
+	devices := []string{serviceConfig.AlarmManager.DeviceId}
+	for _, sensorName := range sortedSensorNames(serviceConfig) {
+		device := serviceConfig.Sensors[sensorName].Device
+		alreadyAdded := false
+		for _, addedDevice := range devices {
+			alreadyAdded = alreadyAdded || addedDevice == device
+		}
+		if !alreadyAdded {
+			devices = append(devices, device)
+		}
 	}
+	return devices
+}
 
-	syslog.Info("Reading service config.")
-	serviceConfig, errConfig := config.ReadConfig()
+func runService(configFileLocation string, dryRun bool) int {
 
+	serviceConfig, errConfig := config.ReadConfigFrom(configFileLocation)
 	if errConfig != nil {
-		panic(errConfig)
+		fmt.Fprintln(os.Stderr, errConfig.Error())
+		return 1
+	}
+
+	log, logErr := logger.New(serviceConfig.Log.Output, serviceConfig.Log.Level, os.Stderr)
+	if logErr != nil {
+		fmt.Fprintln(os.Stderr, logErr.Error())
+		return 1
 	}
+	log.Info("Service config read.", "version", version)
 
 	httpClient := http.Client{
 		Timeout: time.Second * 5, // Maximum of 5 secs
 	}
 
-	redisAddress := fmt.Sprintf("%s:%d", serviceConfig.RedisServer.IP, serviceConfig.RedisServer.Port)
-	redisClient := goredis.NewClient(&goredis.Options{
-		Addr:     redisAddress,
-		Password: serviceConfig.RedisServer.Password,
-		DB:       serviceConfig.RedisServer.Database,
-	})
-
-	ctx := context.Background()
+	// Service stops on SIGINT or SIGTERM once queued notifications are delivered
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	redisErr := redisClient.Set(ctx, "checkKey", "key", 1000000).Err()
+	storageInstance, redisErr := newRedisStorage(ctx, serviceConfig)
 	if redisErr != nil {
-		panic(redisErr)
+		log.Error("Failed to connect to redis.", "error", redisErr)
+		return 1
 	}
-	storageInstance := storage.Storage{RedisClient: redisClient}
 
-	syslog.Info("Establishing connection with alarmManager.")
+	messages, messagesErr := notifier.NewCatalog(serviceConfig.Messages.Locale, serviceConfig.Messages.Templates)
+	if messagesErr != nil {
+		log.Error("Failed to load messages.", "error", messagesErr)
+		return 1
+	}
 
-	watcher := apiwatcher.APIWatcher{Host: serviceConfig.AlarmManager.Host, Port: serviceConfig.AlarmManager.Port}
-	alarmManagerRequester := apiwatcher.Requester{Client: httpClient}
+	ruleEngine, rulesErr := newRuleEngine(serviceConfig)
+	if rulesErr != nil {
+		log.Error("Failed to load rules.", "error", rulesErr)
+		return 1
+	}
 
-	_, apiInfoErr := watcher.ShowInfo(alarmManagerRequester)
-	if apiInfoErr != nil {
-		errorString := fmt.Sprintf("%v", apiInfoErr.Error())
-		syslog.Err(errorString)
-		panic(apiInfoErr)
+	router, routerErr := buildTopicRouter(serviceConfig)
+	if routerErr != nil {
+		log.Error("Failed to build topic router.", "error", routerErr)
+		return 1
+	}
+	subscriptions := serviceConfig.Mqtt.Subscriptions
+	if len(subscriptions) == 0 {
+		subscriptions = router.Subscriptions()
+	}
+	subscriptions = append(subscriptions, availabilitySubscriptions(serviceConfig)...)
+	if serviceConfig.Bypass.CommandTopic != "" {
+		subscriptions = append(subscriptions, serviceConfig.Bypass.CommandTopic)
 	}
 
 	mqttMessages := make(chan [2]string)
-	syslog.Info("Establishing connection with mqtt server.")
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(fmt.Sprintf("tcp://%s:%d", serviceConfig.Mqtt.Host, serviceConfig.Mqtt.Port))
-	opts.SetClientID("windmaker_alarmsensors")
-	opts.SetUsername(serviceConfig.Mqtt.User)
-	opts.SetPassword(serviceConfig.Mqtt.Password)
-	opts.SetPingTimeout(10 * time.Second)
-	opts.SetKeepAlive(10 * time.Second)
-	opts.SetAutoReconnect(true)
-	opts.SetMaxReconnectInterval(10 * time.Second)
-
-	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
-		mqttMessages <- [2]string{msg.Topic(), string(msg.Payload())}
+	client := newMqttClient(serviceConfig.Mqtt, subscriptions, log, mqttMessages)
+	publishFunc := mqttPublisher(client, serviceConfig.Mqtt.QoS)
+
+	dispatcher, dispatcherErr := newDispatcher(ctx, serviceConfig, log, publishFunc)
+	if dispatcherErr != nil {
+		log.Error("Failed to create notifiers.", "error", dispatcherErr)
+		return 1
+	}
+	go reportNotificationMetrics(ctx, dispatcher, log)
+
+	log.Info("Establishing connection with alarmManager.")
+
+	alarmController := alarmmanager.NewAPIController(serviceConfig.AlarmManager.Host, serviceConfig.AlarmManager.Port, httpClient)
+
+	var serviceController alarmmanager.Controller = alarmController
+	// Dry run mode never changes alarm status
+	if dryRun {
+		serviceConfig.DryRun = true
+	}
+	if serviceConfig.DryRun {
+		log.Warn("Dry run mode enabled, alarm status will not be changed.")
+		serviceController = alarmmanager.DryRunController{Controller: alarmController, Observer: func(deviceID string, mode string) {
+			messageKey := notifier.MessageDryRunMode
+			if mode == alarmmanager.SOSMode {
+				messageKey = notifier.MessageDryRunSOS
+			}
+			dryRunMessage := messages.Render(messageKey, notifier.MessageData{Device: deviceID, Mode: mode})
+			log.Warn(dryRunMessage, "device", deviceID, "mode", mode)
+			dispatcher.Dispatch(notifier.Event{Type: notifier.EventDryRun, Message: dryRunMessage, Priority: normalPriority, Device: deviceID, Mode: mode, Time: time.Now()})
+		}}
+	}
+
+	// Alarm modes are tracked in background, fail-safe policy applies while alarmManager is unreachable
+	tracker := alarmmanager.NewTracker(serviceController, storageInstance, alarmDevices(serviceConfig), serviceConfig.AlarmManager.PollInterval, serviceConfig.AlarmManager.FailSafe, serviceConfig.AlarmManager.FailSafeMode)
+
+	// SOS fallback alerts are sent to RabbitMQ whatever sinks are configured
+	queueFunc := func(message string, priority uint8) error {
+		return sendMessageByQueue(serviceConfig.Rabbitmq, message, priority)
+	}
+	alarmService := service{
+		config:      serviceConfig,
+		log:         log,
+		alarm:       tracker,
+		router:      router,
+		storage:     storageInstance,
+		sendFunc:    dispatcher.Dispatch,
+		queueFunc:   queueFunc,
+		publishFunc: publishFunc,
+		messages:    messages,
+		limiter:     newLimiter(serviceConfig, storageInstance),
+		debouncer:   alarmsensors.NewDebouncer(),
+		ruleEngine:  ruleEngine,
+		openAlerts:  newOpenAlerts(),
+		confirms:    newActionConfirmations(),
+	}
+
+	tracker.OnChange(func(deviceID string, previousMode string, mode string) {
+		log.Info("Alarm mode has changed.", "device", deviceID, "previous_mode", previousMode, "mode", mode)
+		alarmService.handleModeChange(ctx, deviceID, previousMode, mode)
+	})
+	if pollErr := tracker.Poll(ctx); pollErr != nil {
+		log.Error("Failed to read alarm mode from alarmManager, fail-safe policy applies.", "failsafe", serviceConfig.AlarmManager.FailSafe, "error", pollErr)
+	}
+	go tracker.Run(ctx, func(pollErr error) {
+		log.Error("Failed to read alarm mode from alarmManager, fail-safe policy applies.", "failsafe", serviceConfig.AlarmManager.FailSafe, "error", pollErr)
 	})
 
-	client := mqtt.NewClient(opts)
+	if serviceConfig.API.Listen != "" {
+		apiServer := &http.Server{Addr: serviceConfig.API.Listen, Handler: alarmService.apiHandler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			log.Info("Starting HTTP API.", "listen", serviceConfig.API.Listen)
+			if listenErr := apiServer.ListenAndServe(); listenErr != nil {
+				log.Error("HTTP API stopped.", "error", listenErr)
+			}
+		}()
+	}
+
+	log.Info("Establishing connection with mqtt server.")
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		errorString := fmt.Sprintf("%v", token.Error())
-		syslog.Err(errorString)
-		panic(token.Error())
+		log.Error("Failed to connect to mqtt server.", "error", token.Error())
+		return 1
 	}
-	sub(client, serviceConfig.Mqtt.WildcardTopic, syslog)
 
-	syslog.Info("Connection established.")
+	go alarmService.superviseSilence(ctx)
+	go alarmService.superviseRateLimits(ctx)
+	go alarmService.superviseFlapping(ctx)
+	go alarmService.superviseRules(ctx)
+	alarmService.restoreOpenAlerts(ctx)
+
+	log.Info("Connection established.")
 
 	for {
-		incoming := <-mqttMessages
-		go handleMessage(ctx, serviceConfig, syslog, watcher, alarmManagerRequester, incoming[0], incoming[1], storageInstance)
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping service, delivering queued notifications.")
+			drainCtx, cancel := context.WithTimeout(context.Background(), notificationsDrainTimeout)
+			defer cancel()
+			if closeErr := dispatcher.Close(drainCtx); closeErr != nil {
+				log.Error("Failed to deliver queued notifications.", "error", closeErr)
+				return 1
+			}
+			return 0
+		case incoming := <-mqttMessages:
+			log.Debug("Message received.", "topic", incoming[0], "payload", incoming[1])
+			go alarmService.handleMessage(ctx, incoming[0], incoming[1])
+		}
 	}
 
 }
+
+func main() {
+	os.Exit(runCommand(os.Args[1:]))
+}
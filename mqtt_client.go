@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	statusOnline  string = "online"
+	statusOffline string = "offline"
+)
+
+func sub(client mqtt.Client, topics []string, qos byte, log *slog.Logger) {
+	for _, topic := range topics {
+		token := client.Subscribe(topic, qos, nil)
+		token.Wait()
+		if token.Error() != nil {
+			log.Error("Failed to subscribe to topic.", "topic", topic, "error", token.Error())
+			continue
+		}
+		log.Info("Subscribed to topic.", "topic", topic)
+	}
+}
+
+func mqttClientID(mqttConfig config.Mqtt) string {
+	switch mqttConfig.ClientIDSuffix {
+	case "hostname":
+		hostname, hostnameErr := os.Hostname()
+		if hostnameErr == nil {
+			return fmt.Sprintf("%s_%s", mqttConfig.ClientID, hostname)
+		}
+	case "random":
+		randomBytes := make([]byte, 4)
+		if _, randomErr := rand.Read(randomBytes); randomErr == nil {
+			return fmt.Sprintf("%s_%s", mqttConfig.ClientID, hex.EncodeToString(randomBytes))
+		}
+	}
+	return mqttConfig.ClientID
+}
+
+// newMqttClient creates MQTT client which subscribes to topics each time connection is established
+func newMqttClient(mqttConfig config.Mqtt, subscriptions []string, log *slog.Logger, mqttMessages chan [2]string) mqtt.Client {
+	clientID := mqttClientID(mqttConfig)
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(fmt.Sprintf("tcp://%s:%d", mqttConfig.Host, mqttConfig.Port))
+	opts.SetClientID(clientID)
+	opts.SetUsername(mqttConfig.User)
+	opts.SetPassword(mqttConfig.Password)
+	opts.SetPingTimeout(10 * time.Second)
+	opts.SetKeepAlive(10 * time.Second)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(10 * time.Second)
+	opts.SetCleanSession(mqttConfig.CleanSession)
+	opts.SetResumeSubs(!mqttConfig.CleanSession)
+	// Broker publishes offline status when service dies
+	if mqttConfig.StatusTopic != "" {
+		opts.SetWill(mqttConfig.StatusTopic, statusOffline, mqttConfig.QoS, true)
+	}
+
+	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
+		mqttMessages <- [2]string{msg.Topic(), string(msg.Payload())}
+	})
+	// Subscriptions are done on every connection, auto reconnect included
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		log.Info("Connected to mqtt server.", "client_id", clientID)
+		sub(client, subscriptions, mqttConfig.QoS, log)
+		if mqttConfig.StatusTopic != "" {
+			token := client.Publish(mqttConfig.StatusTopic, mqttConfig.QoS, true, statusOnline)
+			token.Wait()
+			if token.Error() != nil {
+				log.Error("Failed to publish service status.", "topic", mqttConfig.StatusTopic, "error", token.Error())
+			}
+		}
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.Error("Connection with mqtt server lost.", "error", err)
+	})
+
+	return mqtt.NewClient(opts)
+}
+
+// mqttPublisher publishes messages through connected MQTT client
+func mqttPublisher(client mqtt.Client, qos byte) messagePublisher {
+	return func(topic string, payload string) error {
+		token := client.Publish(topic, qos, false, payload)
+		if !token.WaitTimeout(5 * time.Second) {
+			return fmt.Errorf("timeout publishing to %s", topic)
+		}
+		return token.Error()
+	}
+}
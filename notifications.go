@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	"golang.org/x/net/context"
+)
+
+const notificationMetricsInterval time.Duration = 15 * time.Minute
+
+// newDispatcher registers configured sinks, each webhook is a sink on its own
+func newDispatcher(ctx context.Context, serviceConfig config.Config, log *slog.Logger, publishFunc messagePublisher) (*notifier.Dispatcher, error) {
+	dispatcher := notifier.NewDispatcher(ctx, func(sinkName string, event notifier.Event, err error) {
+		log.Error("Failed to send notification.", "sink", sinkName, "event", event.Type, "error", err)
+	})
+	queueSize := serviceConfig.Notifications.QueueSize
+	for _, sinkName := range serviceConfig.Notifications.Sinks {
+		switch sinkName {
+		case "rabbitmq":
+			dispatcher.AddSink(sinkName, notifier.NotifierFunc(func(ctx context.Context, event notifier.Event) error {
+				// SOS failures are sent to RabbitMQ by escalate without queueing
+				if event.Type == notifier.EventSOSFailed {
+					return nil
+				}
+				return sendMessageByQueue(serviceConfig.Rabbitmq, event.Message, event.Priority)
+			}), queueSize)
+		case "webhooks":
+			for webhookName, webhookConfig := range serviceConfig.Webhooks {
+				webhook, webhookErr := notifier.NewWebhookNotifier(webhookConfig)
+				if webhookErr != nil {
+					return nil, fmt.Errorf("webhook %s: %v", webhookName, webhookErr)
+				}
+				dispatcher.AddSink("webhook:"+webhookName, webhook, queueSize)
+			}
+		case "mqtt":
+			dispatcher.AddSink(sinkName, notifier.MQTTNotifier{Topic: serviceConfig.Notifications.MqttTopic, Publish: publishFunc}, queueSize)
+		case "log":
+			dispatcher.AddSink(sinkName, notifier.LogNotifier{Log: log}, queueSize)
+		}
+	}
+	for _, sinkMetrics := range dispatcher.Metrics() {
+		log.Info("Notification sink enabled.", "sink", sinkMetrics.Name)
+	}
+	return dispatcher, nil
+}
+
+// reportNotificationMetrics logs sinks counters periodically
+func reportNotificationMetrics(ctx context.Context, dispatcher *notifier.Dispatcher, log *slog.Logger) {
+	ticker := time.NewTicker(notificationMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, sinkMetrics := range dispatcher.Metrics() {
+			log.Info("Notification sink metrics.", "sink", sinkMetrics.Name, "sent", sinkMetrics.Sent, "failed", sinkMetrics.Failed, "dropped", sinkMetrics.Dropped, "queued", sinkMetrics.Queued)
+		}
+	}
+}
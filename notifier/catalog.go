@@ -0,0 +1,248 @@
+package notifier
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"text/template"
+)
+
+// Message keys, variants of an event type are named <event type>.<variant>
+const (
+	MessageSensorOpened         string = "sensor_status.opened"
+	MessageSensorClosed         string = "sensor_status.closed"
+	MessageSensorMotion         string = "sensor_status.motion"
+	MessageSensorClear          string = "sensor_status.clear"
+	MessageAlarmTriggered       string = "alarm_triggered"
+	MessageTriggerIgnored       string = "trigger_ignored"
+	MessageAlarmStatusUnknown   string = "alarm_status_unknown"
+	MessageSensorOnline         string = "sensor_availability.online"
+	MessageSensorOffline        string = "sensor_availability.offline"
+	MessageSensorSilent         string = "sensor_availability.silent"
+	MessageBridgeOnline         string = "bridge_state.online"
+	MessageBridgeOffline        string = "bridge_state.offline"
+	MessageBridgeOfflineUnknown string = "bridge_state.offline_unknown"
+	MessageBridgeOfflineArmed   string = "bridge_state.offline_armed"
+	MessageSOSFailed            string = "sos_failed"
+	MessageDryRunSOS            string = "dry_run.sos"
+	MessageDryRunMode           string = "dry_run.mode"
+	MessageDryRunTriggered      string = "dry_run.alarm_triggered"
+	MessageSummary              string = "notification_summary"
+	MessageSensorFlapping       string = "sensor_trouble.flapping"
+	MessageSensorFlappingBypass string = "sensor_trouble.flapping_bypassed"
+	MessageSensorStable         string = "sensor_trouble.stable"
+	MessageTriggerFlapping      string = "trigger_ignored.flapping"
+	MessageTriggerBypassed      string = "trigger_ignored.bypassed"
+	MessageTriggerUnscheduled   string = "trigger_ignored.unscheduled"
+	MessageBypassSet            string = "bypass.set"
+	MessageBypassUntilDisarm    string = "bypass.set_until_disarm"
+	MessageBypassCleared        string = "bypass.cleared"
+	MessageBypassArmed          string = "bypass.armed"
+	MessageNotReady             string = "not_ready"
+	MessageNotReadyBypassed     string = "not_ready.bypassed"
+	MessageNotReadyRefused      string = "not_ready.refused"
+	MessageRuleSOS              string = "rule.sos"
+	MessageRuleSetMode          string = "rule.set_mode"
+	MessageLeftOpen             string = "left_open"
+	MessageLeftOpenClosed       string = "left_open.closed"
+	MessageSensorLeak           string = "sensor_status.leak"
+	MessageSensorDry            string = "sensor_status.dry"
+	MessageSensorSmoke          string = "sensor_status.smoke"
+	MessageSensorSmokeClear     string = "sensor_status.smoke_clear"
+	MessageSensorCO             string = "sensor_status.carbon_monoxide"
+	MessageSensorCOClear        string = "sensor_status.carbon_monoxide_clear"
+	MessageLifeSafetyLeak       string = "life_safety.leak"
+	MessageLifeSafetySmoke      string = "life_safety.smoke"
+	MessageLifeSafetyCO         string = "life_safety.carbon_monoxide"
+	MessageLifeSafetyFailed     string = "sos_failed.life_safety"
+	MessageActionPanic          string = "action.panic"
+	MessageActionSetMode        string = "action.set_mode"
+	MessageActionConfirm        string = "action.confirm"
+	MessageActionFailed         string = "action.failed"
+	MessageDuress               string = "duress"
+)
+
+const DefaultLocale string = "en"
+
+// MessageData is available in message templates, Sensor is sensor friendly name
+type MessageData struct {
+	Sensor       string
+	SensorID     string
+	Room         string
+	Device       string
+	Mode         string
+	Duration     string
+	Error        string
+	Count        int64
+	Sensors      string
+	PreviousMode string
+	Rule         string
+	Until        string
+}
+
+var locales = map[string]map[string]string{
+	"en": {
+		MessageSensorOpened:         "Contact sensor '{{.Sensor}}' has been opened.",
+		MessageSensorClosed:         "Contact sensor '{{.Sensor}}' has been closed.",
+		MessageSensorMotion:         "Motion sensor '{{.Sensor}}' has been triggered.",
+		MessageSensorClear:          "Motion sensor '{{.Sensor}}' is clear.",
+		MessageAlarmTriggered:       "{{.Sensor}} sensor has been triggered and alarm status is {{.Mode}}, triggering alarm.",
+		MessageTriggerIgnored:       "{{.Sensor}} sensor has been triggered but alarm status is {{.Mode}}, NOT triggering alarm.",
+		MessageAlarmStatusUnknown:   "{{.Sensor}} sensor has been triggered but alarm status is unknown, NOT triggering alarm.",
+		MessageSensorOnline:         "Sensor '{{.Sensor}}' is online again.",
+		MessageSensorOffline:        "Sensor '{{.Sensor}}' has been reported offline by coordinator.",
+		MessageSensorSilent:         "Sensor '{{.Sensor}}' has not reported for {{.Duration}}, flagged as offline.",
+		MessageBridgeOnline:         "Zigbee2MQTT coordinator is online again.",
+		MessageBridgeOffline:        "Zigbee2MQTT coordinator is down.",
+		MessageBridgeOfflineUnknown: "Zigbee2MQTT coordinator is down and alarm status is unknown.",
+		MessageBridgeOfflineArmed:   "Zigbee2MQTT coordinator is down while alarm status is {{.Mode}}, sensors are not being watched.",
+		MessageSOSFailed:            "ALARM - {{.Sensor}} sensor has been triggered and alarm status is {{.Mode}} but SOS could not be sent to device {{.Device}}: {{.Error}}",
+		MessageDryRunSOS:            "DRY RUN - would trigger SOS on device {{.Device}}.",
+		MessageDryRunMode:           "DRY RUN - would set device {{.Device}} mode to {{.Mode}}.",
+		MessageDryRunTriggered:      "DRY RUN - {{.Sensor}} sensor has been triggered and alarm status is {{.Mode}}, alarm would be triggered.",
+		MessageSummary:              "{{.Sensor}} changed {{.Count}} times in the last {{.Duration}}.",
+		MessageSensorFlapping:       "Sensor '{{.Sensor}}' is flapping, it changed {{.Count}} times in the last {{.Duration}}.",
+		MessageSensorFlappingBypass: "Sensor '{{.Sensor}}' is flapping, it changed {{.Count}} times in the last {{.Duration}}. It will not trigger alarm until it is stable.",
+		MessageSensorStable:         "Sensor '{{.Sensor}}' is stable again.",
+		MessageTriggerFlapping:      "{{.Sensor}} sensor has been triggered and alarm status is {{.Mode}} but sensor is flapping, NOT triggering alarm.",
+		MessageTriggerBypassed:      "{{.Sensor}} sensor has been triggered and alarm status is {{.Mode}} but sensor is bypassed, NOT triggering alarm.",
+		MessageTriggerUnscheduled:   "{{.Sensor}} sensor has been triggered and alarm status is {{.Mode}} but sensor is outside its schedule, NOT triggering alarm.",
+		MessageBypassSet:            "Sensor '{{.Sensor}}' is bypassed until {{.Until}}.",
+		MessageBypassUntilDisarm:    "Sensor '{{.Sensor}}' is bypassed until next disarm.",
+		MessageBypassCleared:        "Sensor '{{.Sensor}}' is no longer bypassed.",
+		MessageBypassArmed:          "Alarm status is {{.Mode}} with bypassed sensors: {{.Sensors}}.",
+		MessageNotReady:             "Alarm status is {{.Mode}} but it is not ready, open sensors: {{.Sensors}}.",
+		MessageNotReadyBypassed:     "Alarm status is {{.Mode}} but it was not ready, open sensors are bypassed until disarm: {{.Sensors}}.",
+		MessageNotReadyRefused:      "Alarm cannot be set to {{.Mode}}, it is not ready, open sensors: {{.Sensors}}. Alarm status is back to {{.PreviousMode}}.",
+		MessageRuleSOS:              "Rule '{{.Rule}}' has been matched and alarm status is {{.Mode}}, triggering alarm.",
+		MessageRuleSetMode:          "Rule '{{.Rule}}' has been matched, alarm status is set to {{.Mode}}.",
+		MessageLeftOpen:             "{{.Sensor}} has been open for {{.Duration}}.",
+		MessageLeftOpenClosed:       "{{.Sensor}} has been closed after being open for {{.Duration}}.",
+		MessageSensorLeak:           "Water leak sensor '{{.Sensor}}' has detected a leak.",
+		MessageSensorDry:            "Water leak sensor '{{.Sensor}}' is dry.",
+		MessageSensorSmoke:          "Smoke sensor '{{.Sensor}}' has detected smoke.",
+		MessageSensorSmokeClear:     "Smoke sensor '{{.Sensor}}' is clear.",
+		MessageSensorCO:             "Carbon monoxide sensor '{{.Sensor}}' has detected carbon monoxide.",
+		MessageSensorCOClear:        "Carbon monoxide sensor '{{.Sensor}}' is clear.",
+		MessageLifeSafetyLeak:       "EMERGENCY - Water leak detected by {{.Sensor}}, alarm status is set to {{.Mode}}.",
+		MessageLifeSafetySmoke:      "EMERGENCY - Smoke detected by {{.Sensor}}, alarm status is set to {{.Mode}}.",
+		MessageLifeSafetyCO:         "EMERGENCY - Carbon monoxide detected by {{.Sensor}}, alarm status is set to {{.Mode}}.",
+		MessageLifeSafetyFailed:     "EMERGENCY - {{.Sensor}} sensor has been triggered but alarm status could not be set to {{.Mode}} on device {{.Device}}: {{.Error}}",
+		MessageActionPanic:          "PANIC - {{.Sensor}} panic button has been pressed and alarm status is {{.Mode}}, triggering alarm.",
+		MessageActionSetMode:        "Alarm status is set to {{.Mode}} from {{.Sensor}}.",
+		MessageActionConfirm:        "Press {{.Sensor}} again within {{.Duration}} to set alarm status to {{.Mode}}.",
+		MessageActionFailed:         "{{.Sensor}} could not set alarm status to {{.Mode}}: {{.Error}}",
+		MessageDuress:               "DURESS - Duress action has been sent from {{.Sensor}}, alarm status is {{.Mode}}.",
+	},
+	"es": {
+		MessageSensorOpened:         "El sensor de contacto '{{.Sensor}}' se ha abierto.",
+		MessageSensorClosed:         "El sensor de contacto '{{.Sensor}}' se ha cerrado.",
+		MessageSensorMotion:         "El sensor de movimiento '{{.Sensor}}' ha detectado movimiento.",
+		MessageSensorClear:          "El sensor de movimiento '{{.Sensor}}' ya no detecta movimiento.",
+		MessageAlarmTriggered:       "Se ha activado el sensor {{.Sensor}} con la alarma en modo {{.Mode}}, disparando la alarma.",
+		MessageTriggerIgnored:       "Se ha activado el sensor {{.Sensor}} pero la alarma está en modo {{.Mode}}, NO se dispara la alarma.",
+		MessageAlarmStatusUnknown:   "Se ha activado el sensor {{.Sensor}} pero se desconoce el estado de la alarma, NO se dispara la alarma.",
+		MessageSensorOnline:         "El sensor '{{.Sensor}}' vuelve a estar conectado.",
+		MessageSensorOffline:        "El coordinador indica que el sensor '{{.Sensor}}' está desconectado.",
+		MessageSensorSilent:         "El sensor '{{.Sensor}}' no ha enviado datos en {{.Duration}}, se marca como desconectado.",
+		MessageBridgeOnline:         "El coordinador Zigbee2MQTT vuelve a estar conectado.",
+		MessageBridgeOffline:        "El coordinador Zigbee2MQTT está caído.",
+		MessageBridgeOfflineUnknown: "El coordinador Zigbee2MQTT está caído y se desconoce el estado de la alarma.",
+		MessageBridgeOfflineArmed:   "El coordinador Zigbee2MQTT está caído con la alarma en modo {{.Mode}}, los sensores no están siendo vigilados.",
+		MessageSOSFailed:            "ALARMA - Se ha activado el sensor {{.Sensor}} con la alarma en modo {{.Mode}} pero no se ha podido enviar el SOS al dispositivo {{.Device}}: {{.Error}}",
+		MessageDryRunSOS:            "DRY RUN - se dispararía el SOS en el dispositivo {{.Device}}.",
+		MessageDryRunMode:           "DRY RUN - se cambiaría el modo del dispositivo {{.Device}} a {{.Mode}}.",
+		MessageDryRunTriggered:      "DRY RUN - Se ha activado el sensor {{.Sensor}} con la alarma en modo {{.Mode}}, se dispararía la alarma.",
+		MessageSummary:              "{{.Sensor}} ha cambiado {{.Count}} veces en los últimos {{.Duration}}.",
+		MessageSensorFlapping:       "El sensor '{{.Sensor}}' está oscilando, ha cambiado {{.Count}} veces en los últimos {{.Duration}}.",
+		MessageSensorFlappingBypass: "El sensor '{{.Sensor}}' está oscilando, ha cambiado {{.Count}} veces en los últimos {{.Duration}}. No disparará la alarma hasta que se estabilice.",
+		MessageSensorStable:         "El sensor '{{.Sensor}}' vuelve a estar estable.",
+		MessageTriggerFlapping:      "Se ha activado el sensor {{.Sensor}} con la alarma en modo {{.Mode}} pero el sensor está oscilando, NO se dispara la alarma.",
+		MessageTriggerBypassed:      "Se ha activado el sensor {{.Sensor}} con la alarma en modo {{.Mode}} pero el sensor está anulado, NO se dispara la alarma.",
+		MessageTriggerUnscheduled:   "Se ha activado el sensor {{.Sensor}} con la alarma en modo {{.Mode}} pero el sensor está fuera de su horario, NO se dispara la alarma.",
+		MessageBypassSet:            "El sensor '{{.Sensor}}' queda anulado hasta {{.Until}}.",
+		MessageBypassUntilDisarm:    "El sensor '{{.Sensor}}' queda anulado hasta el próximo desarmado.",
+		MessageBypassCleared:        "El sensor '{{.Sensor}}' ya no está anulado.",
+		MessageBypassArmed:          "La alarma está en modo {{.Mode}} con sensores anulados: {{.Sensors}}.",
+		MessageNotReady:             "La alarma está en modo {{.Mode}} pero no está lista, sensores abiertos: {{.Sensors}}.",
+		MessageNotReadyBypassed:     "La alarma está en modo {{.Mode}} pero no estaba lista, los sensores abiertos quedan anulados hasta el desarmado: {{.Sensors}}.",
+		MessageNotReadyRefused:      "No se puede poner la alarma en modo {{.Mode}}, no está lista, sensores abiertos: {{.Sensors}}. La alarma vuelve a modo {{.PreviousMode}}.",
+		MessageRuleSOS:              "Se ha cumplido la regla '{{.Rule}}' con la alarma en modo {{.Mode}}, se dispara la alarma.",
+		MessageRuleSetMode:          "Se ha cumplido la regla '{{.Rule}}', la alarma pasa a modo {{.Mode}}.",
+		MessageLeftOpen:             "{{.Sensor}} lleva abierto {{.Duration}}.",
+		MessageLeftOpenClosed:       "{{.Sensor}} se ha cerrado después de estar abierto {{.Duration}}.",
+		MessageSensorLeak:           "El sensor de agua '{{.Sensor}}' ha detectado una fuga.",
+		MessageSensorDry:            "El sensor de agua '{{.Sensor}}' está seco.",
+		MessageSensorSmoke:          "El sensor de humo '{{.Sensor}}' ha detectado humo.",
+		MessageSensorSmokeClear:     "El sensor de humo '{{.Sensor}}' ya no detecta humo.",
+		MessageSensorCO:             "El sensor de monóxido de carbono '{{.Sensor}}' ha detectado monóxido de carbono.",
+		MessageSensorCOClear:        "El sensor de monóxido de carbono '{{.Sensor}}' ya no detecta monóxido de carbono.",
+		MessageLifeSafetyLeak:       "EMERGENCIA - {{.Sensor}} ha detectado una fuga de agua, la alarma pasa a modo {{.Mode}}.",
+		MessageLifeSafetySmoke:      "EMERGENCIA - {{.Sensor}} ha detectado humo, la alarma pasa a modo {{.Mode}}.",
+		MessageLifeSafetyCO:         "EMERGENCIA - {{.Sensor}} ha detectado monóxido de carbono, la alarma pasa a modo {{.Mode}}.",
+		MessageLifeSafetyFailed:     "EMERGENCIA - Se ha activado el sensor {{.Sensor}} pero no se ha podido poner la alarma en modo {{.Mode}} en el dispositivo {{.Device}}: {{.Error}}",
+		MessageActionPanic:          "PÁNICO - Se ha pulsado el botón de pánico {{.Sensor}} con la alarma en modo {{.Mode}}, se dispara la alarma.",
+		MessageActionSetMode:        "La alarma pasa a modo {{.Mode}} desde {{.Sensor}}.",
+		MessageActionConfirm:        "Pulsa {{.Sensor}} de nuevo antes de {{.Duration}} para poner la alarma en modo {{.Mode}}.",
+		MessageActionFailed:         "{{.Sensor}} no ha podido poner la alarma en modo {{.Mode}}: {{.Error}}",
+		MessageDuress:               "COACCIÓN - Se ha enviado una acción de coacción desde {{.Sensor}}, la alarma está en modo {{.Mode}}.",
+	},
+}
+
+// Catalog renders notification messages of a locale
+type Catalog struct {
+	templates map[string]*template.Template
+}
+
+// Locales returns available locales sorted by name
+func Locales() []string {
+	var localeNames []string
+	for localeName := range locales {
+		localeNames = append(localeNames, localeName)
+	}
+	sort.Strings(localeNames)
+	return localeNames
+}
+
+// NewCatalog creates a catalog for given locale, overrides replace locale templates by message key
+func NewCatalog(locale string, overrides map[string]string) (*Catalog, error) {
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	localeMessages, localeFound := locales[locale]
+	if !localeFound {
+		return nil, errors.New("Unknown locale " + locale + ".")
+	}
+	catalog := &Catalog{templates: make(map[string]*template.Template)}
+	for messageKey, messageTemplate := range localeMessages {
+		catalog.templates[messageKey] = template.Must(template.New(messageKey).Parse(messageTemplate))
+	}
+	for messageKey, messageTemplate := range overrides {
+		if _, knownMessage := localeMessages[messageKey]; !knownMessage {
+			return nil, errors.New("Unknown message " + messageKey + ".")
+		}
+		parsedTemplate, parseErr := template.New(messageKey).Parse(messageTemplate)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		// Unknown fields are only detected on execution
+		if executeErr := parsedTemplate.Execute(&bytes.Buffer{}, MessageData{}); executeErr != nil {
+			return nil, executeErr
+		}
+		catalog.templates[messageKey] = parsedTemplate
+	}
+	return catalog, nil
+}
+
+// Render returns message for given key, key itself is returned when message can not be rendered
+func (catalog *Catalog) Render(messageKey string, data MessageData) string {
+	messageTemplate, found := catalog.templates[messageKey]
+	if !found {
+		return messageKey
+	}
+	var message bytes.Buffer
+	if err := messageTemplate.Execute(&message, data); err != nil {
+		return messageKey
+	}
+	return message.String()
+}
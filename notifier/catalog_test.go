@@ -0,0 +1,48 @@
+package notifier
+
+import "testing"
+
+func TestCatalogLocales(t *testing.T) {
+	for _, locale := range Locales() {
+		catalog, err := NewCatalog(locale, nil)
+		if err != nil {
+			t.Fatalf("NewCatalog %s should not fail, error was %s", locale, err.Error())
+		}
+		// Every locale must translate every message
+		for messageKey := range locales[DefaultLocale] {
+			if _, found := catalog.templates[messageKey]; !found {
+				t.Errorf("Locale %s has no %s message.", locale, messageKey)
+			}
+		}
+	}
+
+	catalog, _ := NewCatalog("es", nil)
+	message := catalog.Render(MessageSensorOpened, MessageData{Sensor: "Puerta principal", SensorID: "0x00158d0001"})
+	if message != "El sensor de contacto 'Puerta principal' se ha abierto." {
+		t.Errorf("Unexpected message %s.", message)
+	}
+}
+
+func TestCatalogOverrides(t *testing.T) {
+	catalog, err := NewCatalog("", map[string]string{MessageAlarmTriggered: "{{.Sensor}} ({{.Room}}) opened while {{.Mode}}!"})
+	if err != nil {
+		t.Fatalf("NewCatalog should not fail, error was %s", err.Error())
+	}
+	message := catalog.Render(MessageAlarmTriggered, MessageData{Sensor: "Front door", Room: "hall", Mode: "armed"})
+	if message != "Front door (hall) opened while armed!" {
+		t.Errorf("Unexpected message %s.", message)
+	}
+	if catalog.Render(MessageSensorClosed, MessageData{Sensor: "Front door"}) != "Contact sensor 'Front door' has been closed." {
+		t.Errorf("Messages without override should use locale template.")
+	}
+
+	if _, err := NewCatalog("fr", nil); err == nil {
+		t.Errorf("NewCatalog with unknown locale should fail.")
+	}
+	if _, err := NewCatalog("en", map[string]string{"door_opened": "Door opened"}); err == nil {
+		t.Errorf("NewCatalog with unknown message should fail.")
+	}
+	if _, err := NewCatalog("en", map[string]string{MessageAlarmTriggered: "{{.Zone}} opened"}); err == nil {
+		t.Errorf("NewCatalog with unknown template field should fail.")
+	}
+}
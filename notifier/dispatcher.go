@@ -0,0 +1,164 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// highPriorityWait is how long high priority events wait for room in full sink queues before being dropped
+var highPriorityWait time.Duration = 5 * time.Second
+
+// ErrDispatcherClosed is returned when events are dispatched after Close
+var ErrDispatcherClosed = errors.New("dispatcher is closed")
+
+// SinkMetrics counts events handled by a sink
+type SinkMetrics struct {
+	Name    string
+	Sent    uint64
+	Failed  uint64
+	Dropped uint64
+	Queued  int
+}
+
+type sink struct {
+	name     string
+	notifier Notifier
+	queue    chan Event
+	sent     atomic.Uint64
+	failed   atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+// Dispatcher fans out events to sinks, each sink has its own queue and worker so a slow or failing sink never blocks others
+type Dispatcher struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	onError func(sinkName string, event Event, err error)
+	mutex   sync.RWMutex
+	sinks   []*sink
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher whose workers run until Close, failed deliveries are reported to onError
+// Notifiers get a context with ctx values which is only cancelled when Close gives up draining queues
+func NewDispatcher(ctx context.Context, onError func(sinkName string, event Event, err error)) *Dispatcher {
+	notifyCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	return &Dispatcher{ctx: notifyCtx, cancel: cancel, onError: onError}
+}
+
+// AddSink registers a notifier and starts its worker, events are dropped while its queue is full
+func (dispatcher *Dispatcher) AddSink(name string, notifier Notifier, queueSize int) {
+	newSink := &sink{name: name, notifier: notifier, queue: make(chan Event, queueSize)}
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	if dispatcher.closed {
+		return
+	}
+	dispatcher.sinks = append(dispatcher.sinks, newSink)
+	dispatcher.workers.Add(1)
+	go dispatcher.work(newSink)
+}
+
+// work delivers queued events until sink queue is closed and drained
+func (dispatcher *Dispatcher) work(worker *sink) {
+	defer dispatcher.workers.Done()
+	for event := range worker.queue {
+		if notifyErr := worker.notifier.Notify(dispatcher.ctx, event); notifyErr != nil {
+			worker.failed.Add(1)
+			if dispatcher.onError != nil {
+				dispatcher.onError(worker.name, event, notifyErr)
+			}
+			continue
+		}
+		worker.sent.Add(1)
+	}
+}
+
+// Dispatch queues event in every interested sink, sinks which dropped it are returned as error
+// Events never wait for full queues except high priority ones, which wait up to 5 seconds
+// Delivery failures are not returned, they are reported to onError and counted in metrics
+func (dispatcher *Dispatcher) Dispatch(event Event) error {
+	var droppedBy []string
+	dispatcher.mutex.RLock()
+	defer dispatcher.mutex.RUnlock()
+	if dispatcher.closed {
+		return fmt.Errorf("event %s not sent: %w", event.Type, ErrDispatcherClosed)
+	}
+	for _, worker := range dispatcher.sinks {
+		if filter, isFilter := worker.notifier.(EventFilter); isFilter && !filter.Accepts(event.Type) {
+			continue
+		}
+		if !enqueue(worker.queue, event) {
+			worker.dropped.Add(1)
+			droppedBy = append(droppedBy, worker.name)
+		}
+	}
+	if len(droppedBy) > 0 {
+		return fmt.Errorf("event %s dropped by full sinks: %s", event.Type, strings.Join(droppedBy, ", "))
+	}
+	return nil
+}
+
+// enqueue adds event to queue, only high priority events wait for room
+func enqueue(queue chan Event, event Event) bool {
+	select {
+	case queue <- event:
+		return true
+	default:
+	}
+	if event.Priority < HighPriority {
+		return false
+	}
+	timer := time.NewTimer(highPriorityWait)
+	defer timer.Stop()
+	select {
+	case queue <- event:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Close stops accepting events and waits until workers have delivered every queued event
+// Pending deliveries are cancelled when ctx is done before queues are drained
+func (dispatcher *Dispatcher) Close(ctx context.Context) error {
+	dispatcher.mutex.Lock()
+	if !dispatcher.closed {
+		dispatcher.closed = true
+		for _, worker := range dispatcher.sinks {
+			close(worker.queue)
+		}
+	}
+	dispatcher.mutex.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		dispatcher.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		dispatcher.cancel()
+		return nil
+	case <-ctx.Done():
+		dispatcher.cancel()
+		return fmt.Errorf("notification queues not drained: %w", ctx.Err())
+	}
+}
+
+// Metrics returns counters of every sink in registration order
+func (dispatcher *Dispatcher) Metrics() []SinkMetrics {
+	dispatcher.mutex.RLock()
+	defer dispatcher.mutex.RUnlock()
+	metrics := make([]SinkMetrics, 0, len(dispatcher.sinks))
+	for _, worker := range dispatcher.sinks {
+		metrics = append(metrics, SinkMetrics{Name: worker.name, Sent: worker.sent.Load(), Failed: worker.failed.Load(), Dropped: worker.dropped.Load(), Queued: len(worker.queue)})
+	}
+	return metrics
+}
@@ -0,0 +1,139 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitForMetrics(dispatcher *Dispatcher, done func([]SinkMetrics) bool) []SinkMetrics {
+	deadline := time.Now().Add(time.Second)
+	metrics := dispatcher.Metrics()
+	for !done(metrics) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		metrics = dispatcher.Metrics()
+	}
+	return metrics
+}
+
+func TestDispatcherIsolatesSinks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failures := make(chan string, 10)
+	dispatcher := NewDispatcher(ctx, func(sinkName string, event Event, err error) {
+		failures <- sinkName
+	})
+	blocked := make(chan struct{})
+	dispatcher.AddSink("slow", NotifierFunc(func(ctx context.Context, event Event) error {
+		<-blocked
+		return nil
+	}), 1)
+	dispatcher.AddSink("failing", NotifierFunc(func(ctx context.Context, event Event) error {
+		return errors.New("unreachable")
+	}), 10)
+	delivered := make(chan Event, 10)
+	dispatcher.AddSink("fast", NotifierFunc(func(ctx context.Context, event Event) error {
+		delivered <- event
+		return nil
+	}), 10)
+
+	for i := 0; i < 3; i++ {
+		dispatcher.Dispatch(Event{Type: EventSensorStatus, Message: "door1 is open"})
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-delivered:
+		case <-time.After(time.Second):
+			t.Fatalf("Fast sink should receive every event while slow sink is blocked.")
+		}
+	}
+
+	metrics := waitForMetrics(dispatcher, func(metrics []SinkMetrics) bool { return metrics[1].Failed == 3 })
+	// First event may already be taken by slow sink worker
+	if metrics[0].Dropped < 1 || metrics[0].Dropped > 2 {
+		t.Errorf("Slow sink should drop events while its queue is full. Returned: %+v.", metrics[0])
+	}
+	if metrics[1].Failed != 3 || len(failures) != 3 {
+		t.Errorf("Failing sink should fail 3 times. Returned: %+v.", metrics[1])
+	}
+	if metrics[2].Sent != 3 {
+		t.Errorf("Fast sink should send 3 events. Returned: %+v.", metrics[2])
+	}
+	close(blocked)
+}
+
+func TestDispatcherFiltersEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dispatcher := NewDispatcher(ctx, nil)
+	webhook, _ := NewWebhookNotifier(WebhookConfig{URL: "http://localhost:1", Events: []string{EventAlarmTriggered}})
+	dispatcher.AddSink("webhook", webhook, 0)
+
+	if err := dispatcher.Dispatch(Event{Type: EventSensorStatus}); err != nil {
+		t.Errorf("Filtered events should not be queued, error was %s", err.Error())
+	}
+	if err := dispatcher.Dispatch(Event{Type: EventAlarmTriggered}); err == nil {
+		t.Errorf("Event should be dropped by sink without queue.")
+	}
+}
+
+func TestDispatcherWaitsForHighPriority(t *testing.T) {
+	highPriorityWait = 100 * time.Millisecond
+	defer func() { highPriorityWait = 5 * time.Second }()
+
+	dispatcher := NewDispatcher(context.Background(), nil)
+	taken := make(chan struct{}, 10)
+	blocked := make(chan struct{})
+	dispatcher.AddSink("slow", NotifierFunc(func(ctx context.Context, event Event) error {
+		taken <- struct{}{}
+		<-blocked
+		return nil
+	}), 1)
+
+	dispatcher.Dispatch(Event{Type: EventSensorStatus})
+	<-taken
+	dispatcher.Dispatch(Event{Type: EventSensorStatus})
+	if err := dispatcher.Dispatch(Event{Type: EventSensorStatus}); err == nil {
+		t.Errorf("Normal priority event should be dropped while queue is full.")
+	}
+	if err := dispatcher.Dispatch(Event{Type: EventAlarmTriggered, Priority: HighPriority}); err == nil {
+		t.Errorf("High priority event should be dropped when queue stays full.")
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		blocked <- struct{}{}
+	}()
+	if err := dispatcher.Dispatch(Event{Type: EventAlarmTriggered, Priority: HighPriority}); err != nil {
+		t.Errorf("High priority event should wait for room in queue, error was %s", err.Error())
+	}
+	close(blocked)
+}
+
+func TestDispatcherCloseDrainsQueues(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dispatcher := NewDispatcher(ctx, nil)
+	dispatcher.AddSink("slow", NotifierFunc(func(ctx context.Context, event Event) error {
+		time.Sleep(5 * time.Millisecond)
+		return ctx.Err()
+	}), 10)
+	for i := 0; i < 5; i++ {
+		dispatcher.Dispatch(Event{Type: EventSensorStatus})
+	}
+	// Service context is done on shutdown, queued events are still delivered
+	cancel()
+
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), time.Second)
+	defer closeCancel()
+	if err := dispatcher.Close(closeCtx); err != nil {
+		t.Errorf("Close should drain queues, error was %s", err.Error())
+	}
+	if metrics := dispatcher.Metrics(); metrics[0].Sent != 5 || metrics[0].Queued != 0 {
+		t.Errorf("Every queued event should be sent before Close returns. Returned: %+v.", metrics[0])
+	}
+	if err := dispatcher.Dispatch(Event{Type: EventSensorStatus}); !errors.Is(err, ErrDispatcherClosed) {
+		t.Errorf("Events dispatched after Close should fail. Returned: %v.", err)
+	}
+}
@@ -0,0 +1,59 @@
+package notifier
+
+import "time"
+
+// Event types sent by service
+const (
+	EventSensorStatus       string = "sensor_status"
+	EventAlarmTriggered     string = "alarm_triggered"
+	EventTriggerIgnored     string = "trigger_ignored"
+	EventAlarmStatusUnknown string = "alarm_status_unknown"
+	EventSensorAvailability string = "sensor_availability"
+	EventBridgeState        string = "bridge_state"
+	EventSOSFailed          string = "sos_failed"
+	EventDryRun             string = "dry_run"
+	EventSummary            string = "notification_summary"
+	EventSensorTrouble      string = "sensor_trouble"
+	EventBypass             string = "bypass"
+	EventNotReady           string = "not_ready"
+	EventRule               string = "rule"
+	EventLeftOpen           string = "left_open"
+	EventLifeSafety         string = "life_safety"
+	EventAction             string = "action"
+	EventDuress             string = "duress"
+)
+
+var eventTypes = map[string]bool{
+	EventSensorStatus:       true,
+	EventAlarmTriggered:     true,
+	EventTriggerIgnored:     true,
+	EventAlarmStatusUnknown: true,
+	EventSensorAvailability: true,
+	EventBridgeState:        true,
+	EventSOSFailed:          true,
+	EventDryRun:             true,
+	EventSummary:            true,
+	EventSensorTrouble:      true,
+	EventBypass:             true,
+	EventNotReady:           true,
+	EventRule:               true,
+	EventLeftOpen:           true,
+	EventLifeSafety:         true,
+	EventAction:             true,
+	EventDuress:             true,
+}
+
+// Event is a notification produced by service, sensor, device and mode are empty when they do not apply
+type Event struct {
+	Type     string    `json:"type"`
+	Message  string    `json:"message"`
+	Priority uint8     `json:"priority"`
+	Sensor   string    `json:"sensor,omitempty"`
+	Device   string    `json:"device,omitempty"`
+	Mode     string    `json:"mode,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+func ValidEventType(eventType string) bool {
+	return eventTypes[eventType]
+}
@@ -0,0 +1,115 @@
+package notifier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	storage "github.com/a-castellano/AlarmSensors/storage"
+)
+
+// LimiterStorage keeps rate limit windows, so limits hold across restarts
+type LimiterStorage interface {
+	GetNotificationWindow(ctx context.Context, key string) (storage.NotificationWindow, bool, error)
+	StoreNotificationWindow(ctx context.Context, key string, window storage.NotificationWindow) error
+	NotificationWindowKeys(ctx context.Context) ([]string, error)
+	DeleteNotificationWindow(ctx context.Context, key string) error
+}
+
+// HighPriority is the lowest priority of events never limited
+const HighPriority uint8 = 9
+
+// Alarm trigger events are never limited, whatever their priority is
+var unlimitedEvents = map[string]bool{
+	EventAlarmTriggered:     true,
+	EventAlarmStatusUnknown: true,
+	EventSOSFailed:          true,
+	EventDryRun:             true,
+	EventLifeSafety:         true,
+	EventAction:             true,
+	EventDuress:             true,
+}
+
+// Limiter limits notifications per sensor and event type within a window and drops repeated messages within dedup window
+type Limiter struct {
+	storage     LimiterStorage
+	window      time.Duration
+	maxEvents   int64
+	dedupWindow time.Duration
+	mutex       sync.Mutex
+}
+
+func NewLimiter(storage LimiterStorage, window time.Duration, maxEvents int, dedupWindow time.Duration) *Limiter {
+	return &Limiter{storage: storage, window: window, maxEvents: int64(maxEvents), dedupWindow: dedupWindow}
+}
+
+func limiterKey(event Event) string {
+	return event.Sensor + ":" + event.Type
+}
+
+// Allow counts event and tells if it has to be sent, windows expired with suppressed events are returned to be summarized
+func (limiter *Limiter) Allow(ctx context.Context, event Event) (bool, []storage.NotificationWindow, error) {
+	if unlimitedEvents[event.Type] || event.Priority >= HighPriority {
+		return true, nil, nil
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	var expired []storage.NotificationWindow
+	now := event.Time.Unix()
+	key := limiterKey(event)
+	window, found, storageErr := limiter.storage.GetNotificationWindow(ctx, key)
+	if storageErr != nil {
+		// Notifications are not lost because of storage failures
+		return true, nil, storageErr
+	}
+	if !found || now-window.Start >= int64(limiter.window.Seconds()) {
+		if found && window.Suppressed > 0 {
+			expired = append(expired, window)
+		}
+		window = storage.NotificationWindow{Sensor: event.Sensor, EventType: event.Type, Start: now}
+	}
+
+	window.Count++
+	allowed := true
+	if window.LastMessage == event.Message && now-window.LastSent < int64(limiter.dedupWindow.Seconds()) {
+		allowed = false
+	} else if limiter.maxEvents > 0 && window.Count > limiter.maxEvents {
+		allowed = false
+	}
+	if allowed {
+		window.LastMessage = event.Message
+		window.LastSent = now
+	} else {
+		window.Suppressed++
+	}
+	return allowed, expired, limiter.storage.StoreNotificationWindow(ctx, key, window)
+}
+
+// Expire removes windows finished before now, the ones with suppressed events are returned to be summarized
+func (limiter *Limiter) Expire(ctx context.Context, now time.Time) ([]storage.NotificationWindow, error) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	var expired []storage.NotificationWindow
+	keys, keysErr := limiter.storage.NotificationWindowKeys(ctx)
+	if keysErr != nil {
+		return expired, keysErr
+	}
+	for _, key := range keys {
+		window, found, storageErr := limiter.storage.GetNotificationWindow(ctx, key)
+		if storageErr != nil {
+			return expired, storageErr
+		}
+		if found && now.Unix()-window.Start < int64(limiter.window.Seconds()) {
+			continue
+		}
+		if found && window.Suppressed > 0 {
+			expired = append(expired, window)
+		}
+		if deleteErr := limiter.storage.DeleteNotificationWindow(ctx, key); deleteErr != nil {
+			return expired, deleteErr
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,93 @@
+package notifier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	storage "github.com/a-castellano/AlarmSensors/storage"
+)
+
+func TestLimiterRateLimit(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLimiter(storage.NewMemoryStorage(), 5*time.Minute, 2, 0)
+	start := time.Unix(1000, 0)
+
+	allowedEvents := 0
+	for i := 0; i < 5; i++ {
+		message := "door1 has been opened."
+		if i%2 == 1 {
+			message = "door1 has been closed."
+		}
+		allowed, _, _ := limiter.Allow(ctx, Event{Type: EventSensorStatus, Sensor: "door1", Message: message, Time: start.Add(time.Duration(i) * time.Second)})
+		if allowed {
+			allowedEvents++
+		}
+	}
+	if allowedEvents != 2 {
+		t.Errorf("Only 2 events should be allowed within window. Allowed: %d.", allowedEvents)
+	}
+	if allowed, _, _ := limiter.Allow(ctx, Event{Type: EventSensorStatus, Sensor: "motion1", Message: "motion1 triggered", Time: start}); !allowed {
+		t.Errorf("Other sensors should not be limited.")
+	}
+	if allowed, _, _ := limiter.Allow(ctx, Event{Type: EventAlarmTriggered, Sensor: "door1", Message: "triggering alarm", Time: start}); !allowed {
+		t.Errorf("Alarm trigger events should always be allowed.")
+	}
+
+	expired, _ := limiter.Expire(ctx, start.Add(time.Minute))
+	if len(expired) != 0 {
+		t.Errorf("Windows should not expire before window duration. Returned: %+v.", expired)
+	}
+	expired, _ = limiter.Expire(ctx, start.Add(6*time.Minute))
+	if len(expired) != 1 || expired[0].Sensor != "door1" || expired[0].Count != 5 || expired[0].Suppressed != 3 {
+		t.Errorf("door1 window should be summarized. Returned: %+v.", expired)
+	}
+}
+
+func TestLimiterDedup(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLimiter(storage.NewMemoryStorage(), 5*time.Minute, 0, 30*time.Second)
+	start := time.Unix(1000, 0)
+
+	event := Event{Type: EventSensorStatus, Sensor: "motion1", Message: "motion1 triggered", Time: start}
+	if allowed, _, _ := limiter.Allow(ctx, event); !allowed {
+		t.Errorf("First event should be allowed.")
+	}
+	event.Time = start.Add(10 * time.Second)
+	if allowed, _, _ := limiter.Allow(ctx, event); allowed {
+		t.Errorf("Repeated event within dedup window should be dropped.")
+	}
+	event.Time = start.Add(45 * time.Second)
+	if allowed, _, _ := limiter.Allow(ctx, event); !allowed {
+		t.Errorf("Repeated event after dedup window should be allowed.")
+	}
+
+	// Expired window is returned when sensor notifies again
+	event.Time = start.Add(10 * time.Minute)
+	allowed, expired, _ := limiter.Allow(ctx, event)
+	if !allowed || len(expired) != 1 || expired[0].Suppressed != 1 {
+		t.Errorf("Previous window should be returned. Returned: %t, %+v.", allowed, expired)
+	}
+}
+
+func TestLimiterHighPriority(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLimiter(storage.NewMemoryStorage(), 5*time.Minute, 1, time.Minute)
+	start := time.Unix(1000, 0)
+
+	for i := 0; i < 3; i++ {
+		event := Event{Type: EventBridgeState, Message: "Zigbee coordinator is offline and alarm is armed.", Priority: HighPriority, Time: start.Add(time.Duration(i) * time.Second)}
+		if allowed, _, _ := limiter.Allow(ctx, event); !allowed {
+			t.Errorf("High priority events should never be limited nor deduplicated. Event %d was dropped.", i)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := limiter.Allow(ctx, Event{Type: EventDryRun, Message: "DRY RUN - would trigger SOS on device 1.", Time: start}); !allowed {
+			t.Errorf("Dry run events should never be limited.")
+		}
+	}
+	limiter.Allow(ctx, Event{Type: EventNotReady, Message: "Alarm is not ready.", Time: start})
+	if allowed, _, _ := limiter.Allow(ctx, Event{Type: EventNotReady, Message: "Alarm is not ready.", Time: start.Add(time.Second)}); allowed {
+		t.Errorf("Normal priority events of the same type should still be limited.")
+	}
+}
@@ -0,0 +1,49 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+)
+
+// Notifier delivers events to a sink
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// EventFilter is implemented by notifiers which are only interested in some event types
+type EventFilter interface {
+	Accepts(eventType string) bool
+}
+
+// NotifierFunc adapts a function to Notifier interface
+type NotifierFunc func(ctx context.Context, event Event) error
+
+func (notifierFunc NotifierFunc) Notify(ctx context.Context, event Event) error {
+	return notifierFunc(ctx, event)
+}
+
+// LogNotifier only writes events to log
+type LogNotifier struct {
+	Log *slog.Logger
+}
+
+func (logNotifier LogNotifier) Notify(ctx context.Context, event Event) error {
+	level := slog.LevelInfo
+	if event.Priority > 0 {
+		level = slog.LevelWarn
+	}
+	logNotifier.Log.Log(ctx, level, event.Message, "event", event.Type, "sensor", event.Sensor, "device", event.Device, "mode", event.Mode)
+	return nil
+}
+
+// MQTTNotifier publishes events encoded as JSON on <topic>/<event type>
+type MQTTNotifier struct {
+	Topic   string
+	Publish func(topic string, payload string) error
+}
+
+func (mqttNotifier MQTTNotifier) Notify(ctx context.Context, event Event) error {
+	payload, _ := json.Marshal(event)
+	return mqttNotifier.Publish(mqttNotifier.Topic+"/"+event.Type, string(payload))
+}
@@ -0,0 +1,149 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+const DefaultSignatureHeader string = "X-Signature-256"
+
+// WebhookConfig describes an HTTP endpoint receiving events
+type WebhookConfig struct {
+	URL             string
+	Method          string
+	Events          []string
+	Headers         map[string]string
+	ContentType     string
+	Body            string
+	Secret          string
+	SignatureHeader string
+	Retries         int
+	Backoff         time.Duration
+	Timeout         time.Duration
+}
+
+// WebhookNotifier sends events to an HTTP endpoint
+type WebhookNotifier struct {
+	config   WebhookConfig
+	events   map[string]bool
+	template *template.Template
+	client   *http.Client
+}
+
+var templateFuncs = template.FuncMap{
+	// json encodes values, so messages can be embedded in JSON bodies
+	"json": func(value interface{}) (string, error) {
+		encodedValue, err := json.Marshal(value)
+		return string(encodedValue), err
+	},
+}
+
+// ParseBodyTemplate parses a webhook body template, events are its data
+func ParseBodyTemplate(body string) (*template.Template, error) {
+	return template.New("body").Funcs(templateFuncs).Parse(body)
+}
+
+func NewWebhookNotifier(config WebhookConfig) (*WebhookNotifier, error) {
+	webhook := &WebhookNotifier{config: config, events: make(map[string]bool), client: &http.Client{Timeout: config.Timeout}}
+	if webhook.config.Method == "" {
+		webhook.config.Method = http.MethodPost
+	}
+	if webhook.config.ContentType == "" {
+		webhook.config.ContentType = "application/json"
+	}
+	if webhook.config.SignatureHeader == "" {
+		webhook.config.SignatureHeader = DefaultSignatureHeader
+	}
+	for _, eventType := range config.Events {
+		webhook.events[eventType] = true
+	}
+	if config.Body != "" {
+		bodyTemplate, templateErr := ParseBodyTemplate(config.Body)
+		if templateErr != nil {
+			return nil, templateErr
+		}
+		webhook.template = bodyTemplate
+	}
+	return webhook, nil
+}
+
+// Accepts returns true if webhook is interested in given event type, webhooks without event list accept all
+func (webhook *WebhookNotifier) Accepts(eventType string) bool {
+	return len(webhook.events) == 0 || webhook.events[eventType]
+}
+
+// Body renders event using body template, event is encoded as JSON when there is no template
+func (webhook *WebhookNotifier) Body(event Event) ([]byte, error) {
+	if webhook.template == nil {
+		return json.Marshal(event)
+	}
+	var body bytes.Buffer
+	if err := webhook.template.Execute(&body, event); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// Notify sends event if accepted, failed requests are retried with backoff
+func (webhook *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	if !webhook.Accepts(event.Type) {
+		return nil
+	}
+	body, bodyErr := webhook.Body(event)
+	if bodyErr != nil {
+		return bodyErr
+	}
+	backoff := webhook.config.Backoff
+	retry, sendErr := webhook.send(ctx, body)
+	for attempt := 1; sendErr != nil && retry && attempt <= webhook.config.Retries; attempt++ {
+		select {
+		case <-ctx.Done():
+			return sendErr
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		retry, sendErr = webhook.send(ctx, body)
+	}
+	return sendErr
+}
+
+// send makes a single request, returned bool tells if failure is worth retrying
+func (webhook *WebhookNotifier) send(ctx context.Context, body []byte) (bool, error) {
+	request, requestErr := http.NewRequestWithContext(ctx, webhook.config.Method, webhook.config.URL, bytes.NewReader(body))
+	if requestErr != nil {
+		return false, requestErr
+	}
+	request.Header.Set("Content-Type", webhook.config.ContentType)
+	for header, value := range webhook.config.Headers {
+		request.Header.Set(header, value)
+	}
+	if webhook.config.Secret != "" {
+		request.Header.Set(webhook.config.SignatureHeader, "sha256="+Sign(webhook.config.Secret, body))
+	}
+	response, responseErr := webhook.client.Do(request)
+	if responseErr != nil {
+		return true, responseErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		// Client errors will fail again, except rate limits
+		retry := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("webhook %s returned status %d", webhook.config.URL, response.StatusCode)
+	}
+	return false, nil
+}
+
+// Sign returns hex encoded HMAC-SHA256 of body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
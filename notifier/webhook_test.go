@@ -0,0 +1,93 @@
+package notifier
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookTemplateHeadersAndSignature(t *testing.T) {
+	var receivedBody, receivedSignature, receivedToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receivedBody = string(body)
+		receivedSignature = r.Header.Get("X-Signature-256")
+		receivedToken = r.Header.Get("X-Token")
+	}))
+	defer server.Close()
+
+	webhook, err := NewWebhookNotifier(WebhookConfig{
+		URL:     server.URL,
+		Events:  []string{EventAlarmTriggered},
+		Headers: map[string]string{"X-Token": "secret-token"},
+		Body:    `{"content": {{json .Message}}}`,
+		Secret:  "secret",
+	})
+	if err != nil {
+		t.Fatalf("NewWebhookNotifier should not fail, error was %s", err.Error())
+	}
+
+	event := Event{Type: EventAlarmTriggered, Message: `door1 "opened"`}
+	if err := webhook.Notify(context.Background(), event); err != nil {
+		t.Fatalf("Notify should not fail, error was %s", err.Error())
+	}
+	if receivedBody != `{"content": "door1 \"opened\""}` {
+		t.Errorf("Unexpected body %s.", receivedBody)
+	}
+	if receivedSignature != "sha256="+Sign("secret", []byte(receivedBody)) {
+		t.Errorf("Unexpected signature %s.", receivedSignature)
+	}
+	if receivedToken != "secret-token" {
+		t.Errorf("Custom header should be sent. Returned: %s.", receivedToken)
+	}
+}
+
+func TestWebhookFiltersEvents(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	webhook, _ := NewWebhookNotifier(WebhookConfig{URL: server.URL, Events: []string{EventAlarmTriggered}})
+	webhook.Notify(context.Background(), Event{Type: EventSensorStatus, Message: "door1 is open"})
+	if requests != 0 {
+		t.Errorf("Filtered events should not be sent. Requests: %d.", requests)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	webhook, _ := NewWebhookNotifier(WebhookConfig{URL: server.URL, Retries: 3, Backoff: time.Millisecond})
+	if err := webhook.Notify(context.Background(), Event{Type: EventSOSFailed}); err != nil {
+		t.Errorf("Notify should succeed after retries, error was %s", err.Error())
+	}
+	if requests != 3 {
+		t.Errorf("Webhook should be called 3 times. Called: %d.", requests)
+	}
+
+	requests = 0
+	badRequestServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer badRequestServer.Close()
+	webhook, _ = NewWebhookNotifier(WebhookConfig{URL: badRequestServer.URL, Retries: 3, Backoff: time.Millisecond})
+	if err := webhook.Notify(context.Background(), Event{Type: EventSOSFailed}); err == nil {
+		t.Errorf("Notify should fail when endpoint rejects request.")
+	}
+	if requests != 1 {
+		t.Errorf("Client errors should not be retried. Called: %d.", requests)
+	}
+}
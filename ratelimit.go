@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+const rateLimitCheckInterval time.Duration = 30 * time.Second
+
+// newLimiter returns nil when neither rate limit nor dedup window are set
+func newLimiter(serviceConfig config.Config, limiterStorage notifier.LimiterStorage) *notifier.Limiter {
+	if serviceConfig.RateLimit.MaxEvents == 0 && serviceConfig.RateLimit.DedupWindow == 0 {
+		return nil
+	}
+	return notifier.NewLimiter(limiterStorage, serviceConfig.RateLimit.Window, serviceConfig.RateLimit.MaxEvents, serviceConfig.RateLimit.DedupWindow)
+}
+
+// shortDuration formats durations without trailing zero units, 5m instead of 5m0s
+func shortDuration(duration time.Duration) string {
+	formatted := duration.String()
+	if strings.HasSuffix(formatted, "m0s") {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if strings.HasSuffix(formatted, "h0m") {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
+
+// summarize notifies how many times sensors changed while their notifications were suppressed
+func (s service) summarize(windows []storage.NotificationWindow) {
+	for _, window := range windows {
+		data := notifier.MessageData{Sensor: window.Sensor, SensorID: window.Sensor, Count: window.Count, Duration: shortDuration(s.config.RateLimit.Window)}
+		if window.Sensor == "" {
+			data.Sensor = window.EventType
+		}
+		summaryMessage := s.message(notifier.MessageSummary, data)
+		s.log.Info(summaryMessage, "sensor", window.Sensor, "event", window.EventType, "suppressed", window.Suppressed)
+		summaryEvent := notifier.Event{Type: notifier.EventSummary, Message: summaryMessage, Priority: normalPriority, Sensor: window.Sensor, Time: time.Now()}
+		if sendErr := s.sendFunc(summaryEvent); sendErr != nil {
+			s.log.Error("Failed to send message.", "error", sendErr)
+		}
+	}
+}
+
+// superviseRateLimits summarizes finished rate limit windows
+func (s service) superviseRateLimits(ctx context.Context) {
+	if s.limiter == nil {
+		return
+	}
+	ticker := time.NewTicker(rateLimitCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		expired, expireErr := s.limiter.Expire(ctx, time.Now())
+		if expireErr != nil {
+			s.log.Error("Failed to expire notification rate limits.", "error", expireErr)
+		}
+		s.summarize(expired)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	alarmsensors "github.com/a-castellano/AlarmSensors/alarmsensors"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+// openSensors returns contact sensors triggering in mode on device which are stored as open, bypassed sensors are skipped
+// Motion and life-safety sensors are never reported, untyped sensors are only reported when their last value was a contact one
+func (s service) openSensors(ctx context.Context, deviceID string, mode string) []string {
+	var open []string
+	for _, sensorName := range sortedSensorNames(s.config) {
+		sensor := s.config.Sensors[sensorName]
+		if sensor.Type != "" && sensor.Type != alarmsensors.KindContact {
+			continue
+		}
+		if sensor.Device != deviceID || !sensor.SensorTriggers[mode] || !sensorScheduled(s.config, sensorName, mode, time.Now()) {
+			continue
+		}
+		sensorStatus, found, statusErr := s.storage.GetSensorStatus(ctx, sensorName)
+		if statusErr != nil {
+			s.log.Error("Failed to read sensor status.", "sensor", sensorName, "error", statusErr)
+			continue
+		}
+		if !found || !sensorStatus.Activated || (sensor.Type == "" && sensorStatus.Kind != alarmsensors.KindContact) {
+			continue
+		}
+		if _, bypassed, _ := s.storage.GetBypass(ctx, sensorName); bypassed {
+			continue
+		}
+		open = append(open, sensorName)
+	}
+	return open
+}
+
+// checkReadiness applies readiness policy when alarm is armed from disarmed, it returns false if arming has been refused
+func (s service) checkReadiness(ctx context.Context, deviceID string, previousMode string, mode string) bool {
+	if s.config.Readiness.Policy == "none" || previousMode == "" || !alarmIsDisarmed(s.config, previousMode) || !alarmIsArmed(s.config, mode) {
+		return true
+	}
+	open := s.openSensors(ctx, deviceID, mode)
+	if len(open) == 0 {
+		return true
+	}
+	friendlyNames := make([]string, 0, len(open))
+	for _, sensorName := range open {
+		friendlyNames = append(friendlyNames, s.config.Sensors[sensorName].FriendlyName)
+	}
+	sort.Strings(friendlyNames)
+	data := notifier.MessageData{Device: deviceID, Mode: mode, PreviousMode: previousMode, Sensors: strings.Join(friendlyNames, ", ")}
+	readinessLog := s.log.With("device", deviceID, "previous_mode", previousMode, "mode", mode, "open_sensors", open)
+
+	messageKey := notifier.MessageNotReady
+	priority := normalPriority
+	armed := true
+	switch s.config.Readiness.Policy {
+	case "bypass":
+		now := time.Now()
+		for _, sensorName := range open {
+			if setErr := s.storage.SetBypass(ctx, storage.Bypass{Sensor: sensorName, UntilDisarm: true, Created: now.Unix()}); setErr != nil {
+				readinessLog.Error("Failed to bypass open sensor.", "sensor", sensorName, "error", setErr)
+			}
+		}
+		messageKey = notifier.MessageNotReadyBypassed
+	case "refuse":
+		if setErr := s.alarm.SetMode(deviceID, previousMode); setErr != nil {
+			readinessLog.Error("Failed to refuse alarm mode, alarm remains armed.", "error", setErr)
+			priority = highPriority
+			break
+		}
+		messageKey = notifier.MessageNotReadyRefused
+		priority = highPriority
+		armed = false
+	}
+	readinessMessage := s.message(messageKey, data)
+	readinessLog.Warn(readinessMessage)
+	s.send(notifier.Event{Type: notifier.EventNotReady, Message: readinessMessage, Priority: priority, Device: deviceID, Mode: mode})
+	return armed
+}
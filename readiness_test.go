@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	alarmsensors "github.com/a-castellano/AlarmSensors/alarmsensors"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+func newReadinessTestService(t *testing.T, policy string, sent *[]notifier.Event) (service, *storage.MemoryStorage, *simulatedController) {
+	memoryStorage := storage.NewMemoryStorage()
+	readinessService := newBypassTestService(t, memoryStorage, sent)
+	readinessService.config.Readiness.Policy = policy
+	controller := &simulatedController{out: io.Discard, mode: "armed"}
+	readinessService.alarm = controller
+	ctx := context.Background()
+	alarmsensors.ApplySensorValue(ctx, "window1", alarmsensors.SensorValue{Kind: alarmsensors.KindContact, Value: false}, memoryStorage)
+	alarmsensors.ApplySensorValue(ctx, "door1", alarmsensors.SensorValue{Kind: alarmsensors.KindContact, Value: true}, memoryStorage)
+	alarmsensors.ApplySensorValue(ctx, "motion1", alarmsensors.SensorValue{Kind: alarmsensors.KindOccupancy, Value: true}, memoryStorage)
+	return readinessService, memoryStorage, controller
+}
+
+func TestReadinessNotify(t *testing.T) {
+	var sent []notifier.Event
+	readinessService, _, _ := newReadinessTestService(t, "notify", &sent)
+
+	readinessService.handleModeChange(context.Background(), "1", "disarmed", "home_armed")
+	if len(sent) != 1 || sent[0].Type != notifier.EventNotReady || sent[0].Message != "Alarm status is home_armed but it is not ready, open sensors: window1." {
+		t.Errorf("Not ready event should list window1. Returned: %v.", sent)
+	}
+
+	sent = nil
+	readinessService.handleModeChange(context.Background(), "1", "home_armed", "armed")
+	if len(sent) != 0 {
+		t.Errorf("Readiness is only checked when alarm is armed from disarmed. Returned: %v.", sent)
+	}
+}
+
+func TestReadinessBypass(t *testing.T) {
+	var sent []notifier.Event
+	readinessService, memoryStorage, _ := newReadinessTestService(t, "bypass", &sent)
+
+	readinessService.handleModeChange(context.Background(), "1", "disarmed", "armed")
+	bypasses, _ := memoryStorage.ListBypasses(context.Background())
+	if len(bypasses) != 1 || bypasses[0].Sensor != "window1" || !bypasses[0].UntilDisarm {
+		t.Errorf("Only open contact sensors should be bypassed until disarm. Returned: %+v.", bypasses)
+	}
+	if len(sent) != 2 || sent[0].Message != "Alarm status is armed but it was not ready, open sensors are bypassed until disarm: window1." {
+		t.Errorf("Bypassed open sensors should be notified. Returned: %v.", sent)
+	}
+}
+
+func TestReadinessRefuse(t *testing.T) {
+	var sent []notifier.Event
+	readinessService, _, controller := newReadinessTestService(t, "refuse", &sent)
+
+	readinessService.handleModeChange(context.Background(), "1", "disarmed", "home_armed")
+	if controller.mode != "disarmed" {
+		t.Errorf("Alarm should be set back to disarmed. Returned: %s.", controller.mode)
+	}
+	if len(sent) != 1 || sent[0].Priority != highPriority || sent[0].Message != "Alarm cannot be set to home_armed, it is not ready, open sensors: window1. Alarm status is back to disarmed." {
+		t.Errorf("Refused arming should be notified with high priority. Returned: %v.", sent)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	rules "github.com/a-castellano/AlarmSensors/rules"
+	"golang.org/x/net/context"
+)
+
+const rulesCheckInterval time.Duration = 30 * time.Second
+
+// newRuleEngine returns nil when no rule is declared
+func newRuleEngine(serviceConfig config.Config) (*rules.Engine, error) {
+	if len(serviceConfig.Rules) == 0 {
+		return nil, nil
+	}
+	return rules.NewEngine(serviceConfig.Rules)
+}
+
+// transitionsKeep returns how long sensor transitions are kept, they are not recorded when it is 0
+func transitionsKeep(serviceConfig config.Config) time.Duration {
+	var keep time.Duration
+	if serviceConfig.Flapping.MaxTransitions > 0 {
+		keep = max(serviceConfig.Flapping.Window, serviceConfig.Flapping.StableAfter)
+	}
+	if len(serviceConfig.Rules) > 0 {
+		keep = max(keep, serviceConfig.RuleEngine.History)
+	}
+	return keep
+}
+
+// recordTransition records a sensor transition for flapping detection and rules history
+func (s service) recordTransition(ctx context.Context, sensorLog *slog.Logger, sensorName string, at time.Time) {
+	keep := transitionsKeep(s.config)
+	if keep == 0 {
+		return
+	}
+	if recordErr := s.storage.RecordTransition(ctx, sensorName, at, keep); recordErr != nil {
+		sensorLog.Error("Failed to record sensor transition.", "error", recordErr)
+	}
+}
+
+// ruleEnv builds rules environment from stored sensors status and device alarm mode
+func (s service) ruleEnv(ctx context.Context, device string, now time.Time, sensorName string, event string) rules.Env {
+	env := rules.NewEnv(now)
+	env.Event = event
+	if mode, modeErr := s.alarm.CurrentMode(device); modeErr != nil {
+		s.log.Error("Failed to read alarm mode for rules.", "device", device, "error", modeErr)
+	} else {
+		env.Mode = mode
+	}
+	for _, name := range sortedSensorNames(s.config) {
+		sensor := s.config.Sensors[name]
+		state := rules.SensorState{Name: name, FriendlyName: sensor.FriendlyName, Room: sensor.Room}
+		sensorStatus, found, statusErr := s.storage.GetSensorStatus(ctx, name)
+		if statusErr != nil {
+			s.log.Error("Failed to read sensor status.", "sensor", name, "error", statusErr)
+		}
+		if found {
+			state.Activated = sensorStatus.Activated
+			state.Offline = sensorStatus.Offline
+			state.Flapping = sensorStatus.Flapping
+			state.LastUpdated = time.Unix(sensorStatus.LastUpdated, 0)
+			if sensorStatus.ChangedAt > 0 {
+				state.Since = now.Sub(time.Unix(sensorStatus.ChangedAt, 0))
+			}
+		}
+		_, state.Bypassed, _ = s.storage.GetBypass(ctx, name)
+		env.Sensors[name] = state
+	}
+	env.Sensor = env.Sensors[sensorName]
+	env.Transitions = func(name string, window string) int {
+		duration, durationErr := time.ParseDuration(window)
+		if durationErr != nil {
+			s.log.Error("Invalid rule transitions window.", "window", window, "error", durationErr)
+			return 0
+		}
+		transitions, countErr := s.storage.CountTransitions(ctx, name, now.Add(-duration))
+		if countErr != nil {
+			s.log.Error("Failed to count sensor transitions.", "sensor", name, "error", countErr)
+		}
+		return int(transitions)
+	}
+	return env
+}
+
+// evaluateRules evaluates rules after a sensor change, sensorName and event are empty on periodic evaluations
+func (s service) evaluateRules(ctx context.Context, sensorName string, event string) {
+	if s.ruleEngine == nil {
+		return
+	}
+	now := time.Now()
+	for _, device := range s.ruleEngine.Devices() {
+		env := s.ruleEnv(ctx, device, now, sensorName, event)
+		firings, evaluateErrs := s.ruleEngine.Evaluate(device, env)
+		for _, evaluateErr := range evaluateErrs {
+			s.log.Error("Failed to evaluate rule.", "device", device, "error", evaluateErr)
+		}
+		for _, firing := range firings {
+			s.fireRule(ctx, firing, env)
+		}
+	}
+}
+
+func (s service) fireRule(ctx context.Context, firing rules.Firing, env rules.Env) {
+	rule := firing.Rule
+	ruleLog := s.log.With("rule", rule.Name, "action", rule.Action, "device", rule.Device, "mode", env.Mode)
+	if env.Sensor.Name != "" {
+		ruleLog = ruleLog.With("sensor", env.Sensor.Name)
+	}
+	switch rule.Action {
+	case rules.ActionSOS:
+		logMessage := s.message(notifier.MessageRuleSOS, notifier.MessageData{Rule: rule.Name, Device: rule.Device, Mode: env.Mode})
+		ruleLog.Warn(logMessage)
+		s.send(notifier.Event{Type: notifier.EventAlarmTriggered, Message: logMessage, Priority: highPriority, Sensor: env.Sensor.Name, Device: rule.Device, Mode: env.Mode})
+		s.triggerSOS(ctx, ruleLog, env.Sensor.Name, rule.Device, env.Mode)
+	case rules.ActionNotify:
+		priority := normalPriority
+		if rule.HighPriority {
+			priority = highPriority
+		}
+		ruleLog.Info(firing.Message)
+		s.send(notifier.Event{Type: notifier.EventRule, Message: firing.Message, Priority: priority, Sensor: env.Sensor.Name, Device: rule.Device, Mode: env.Mode})
+	case rules.ActionSetMode:
+		if setErr := s.alarm.SetMode(rule.Device, rule.Mode); setErr != nil {
+			ruleLog.Error("Failed to set alarm mode from rule.", "new_mode", rule.Mode, "error", setErr)
+			return
+		}
+		logMessage := s.message(notifier.MessageRuleSetMode, notifier.MessageData{Rule: rule.Name, Device: rule.Device, Mode: rule.Mode})
+		ruleLog.Warn(logMessage)
+		s.send(notifier.Event{Type: notifier.EventRule, Message: logMessage, Priority: normalPriority, Sensor: env.Sensor.Name, Device: rule.Device, Mode: rule.Mode})
+	case rules.ActionPublish:
+		if publishErr := s.publishFunc(rule.Topic, firing.Payload); publishErr != nil {
+			ruleLog.Error("Failed to publish rule payload.", "topic", rule.Topic, "error", publishErr)
+			return
+		}
+		ruleLog.Info("Rule payload published.", "topic", rule.Topic)
+	}
+}
+
+// superviseRules evaluates rules periodically, time based conditions are matched without sensor messages
+func (s service) superviseRules(ctx context.Context) {
+	if s.ruleEngine == nil {
+		return
+	}
+	ticker := time.NewTicker(rulesCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.evaluateRules(ctx, "", "")
+	}
+}
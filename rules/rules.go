@@ -0,0 +1,201 @@
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Rule actions
+const (
+	ActionSOS     string = "sos"
+	ActionNotify  string = "notify"
+	ActionSetMode string = "set_mode"
+	ActionPublish string = "publish"
+)
+
+// Rule fires its action when When expression becomes true
+type Rule struct {
+	Name         string
+	When         string
+	Action       string
+	Device       string
+	Message      string
+	HighPriority bool
+	Mode         string
+	Topic        string
+	Payload      string
+	Cooldown     time.Duration
+}
+
+// SensorState is a sensor as seen by rule expressions
+type SensorState struct {
+	Name         string        `expr:"name"`
+	FriendlyName string        `expr:"friendly_name"`
+	Room         string        `expr:"room"`
+	Activated    bool          `expr:"activated"`
+	Offline      bool          `expr:"offline"`
+	Flapping     bool          `expr:"flapping"`
+	Bypassed     bool          `expr:"bypassed"`
+	Since        time.Duration `expr:"since"`
+	LastUpdated  time.Time     `expr:"last_updated"`
+}
+
+// Env is the data rule expressions and templates are evaluated against
+type Env struct {
+	Mode        string                   `expr:"mode"`
+	Now         time.Time                `expr:"now"`
+	Hour        int                      `expr:"hour"`
+	Minute      int                      `expr:"minute"`
+	Weekday     string                   `expr:"weekday"`
+	Event       string                   `expr:"event"`
+	Sensor      SensorState              `expr:"sensor"`
+	Sensors     map[string]SensorState   `expr:"sensors"`
+	Transitions func(string, string) int `expr:"transitions"`
+}
+
+// NewEnv fills time fields from now
+func NewEnv(now time.Time) Env {
+	return Env{Now: now, Hour: now.Hour(), Minute: now.Minute(), Weekday: now.Weekday().String()[:3], Sensors: make(map[string]SensorState)}
+}
+
+type compiledRule struct {
+	rule     Rule
+	program  *vm.Program
+	message  *template.Template
+	payload  *template.Template
+	lastFire time.Time
+	// eventDriven rules read event or sensor, they are only evaluated on sensor changes and matched per sensor
+	eventDriven bool
+	matched     map[string]bool
+}
+
+// Firing is a rule whose condition has become true, templates are already rendered
+type Firing struct {
+	Rule    Rule
+	Message string
+	Payload string
+}
+
+// Engine evaluates rules, it is safe for concurrent use
+type Engine struct {
+	mutex sync.Mutex
+	rules []*compiledRule
+}
+
+// NewEngine compiles rules, expressions must return a boolean
+func NewEngine(rules []Rule) (*Engine, error) {
+	engine := &Engine{}
+	for _, rule := range rules {
+		compiled, compileErr := compile(rule)
+		if compileErr != nil {
+			return nil, fmt.Errorf("rule %s %v", rule.Name, compileErr)
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+	sort.Slice(engine.rules, func(i, j int) bool { return engine.rules[i].rule.Name < engine.rules[j].rule.Name })
+	return engine, nil
+}
+
+func compile(rule Rule) (*compiledRule, error) {
+	compiled := &compiledRule{rule: rule, matched: make(map[string]bool)}
+	switch rule.Action {
+	case ActionSOS:
+	case ActionNotify:
+		if rule.Message == "" {
+			return nil, fmt.Errorf("notify action requires message")
+		}
+	case ActionSetMode:
+		if rule.Mode == "" {
+			return nil, fmt.Errorf("set_mode action requires mode")
+		}
+	case ActionPublish:
+		if rule.Topic == "" {
+			return nil, fmt.Errorf("publish action requires topic")
+		}
+	default:
+		return nil, fmt.Errorf("has invalid action %s, it must be sos, notify, set_mode or publish", rule.Action)
+	}
+	program, compileErr := expr.Compile(rule.When, expr.Env(Env{}), expr.AsBool())
+	if compileErr != nil {
+		return nil, fmt.Errorf("has invalid when expression: %v", compileErr)
+	}
+	compiled.program = program
+	compiled.eventDriven = ast.Find(program.Node(), func(node ast.Node) bool {
+		identifier, isIdentifier := node.(*ast.IdentifierNode)
+		return isIdentifier && (identifier.Value == "event" || identifier.Value == "sensor")
+	}) != nil
+	var templateErr error
+	if compiled.message, templateErr = template.New(rule.Name).Parse(rule.Message); templateErr != nil {
+		return nil, fmt.Errorf("has invalid message: %v", templateErr)
+	}
+	if compiled.payload, templateErr = template.New(rule.Name).Parse(rule.Payload); templateErr != nil {
+		return nil, fmt.Errorf("has invalid payload: %v", templateErr)
+	}
+	return compiled, nil
+}
+
+// Devices returns alarmManager devices used by rules
+func (engine *Engine) Devices() []string {
+	var devices []string
+	seen := make(map[string]bool)
+	for _, compiled := range engine.rules {
+		if !seen[compiled.rule.Device] {
+			seen[compiled.rule.Device] = true
+			devices = append(devices, compiled.rule.Device)
+		}
+	}
+	return devices
+}
+
+// Evaluate returns device rules whose condition was false on previous evaluation and it is true now, cooldown is respected.
+// Periodic evaluations, without env sensor, skip event driven rules.
+func (engine *Engine) Evaluate(device string, env Env) ([]Firing, []error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	var firings []Firing
+	var errs []error
+	for _, compiled := range engine.rules {
+		if compiled.rule.Device != device || (compiled.eventDriven && env.Sensor.Name == "") {
+			continue
+		}
+		result, runErr := expr.Run(compiled.program, env)
+		if runErr != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %v", compiled.rule.Name, runErr))
+			continue
+		}
+		matchKey := ""
+		if compiled.eventDriven {
+			matchKey = env.Sensor.Name
+		}
+		matched := result.(bool)
+		wasMatched := compiled.matched[matchKey]
+		compiled.matched[matchKey] = matched
+		if !matched || wasMatched {
+			continue
+		}
+		if compiled.rule.Cooldown > 0 && !compiled.lastFire.IsZero() && env.Now.Sub(compiled.lastFire) < compiled.rule.Cooldown {
+			continue
+		}
+		compiled.lastFire = env.Now
+		firing := Firing{Rule: compiled.rule}
+		var message, payload bytes.Buffer
+		if renderErr := compiled.message.Execute(&message, env); renderErr != nil {
+			errs = append(errs, fmt.Errorf("rule %s message: %v", compiled.rule.Name, renderErr))
+		}
+		if renderErr := compiled.payload.Execute(&payload, env); renderErr != nil {
+			errs = append(errs, fmt.Errorf("rule %s payload: %v", compiled.rule.Name, renderErr))
+		}
+		firing.Message = message.String()
+		firing.Payload = payload.String()
+		firings = append(firings, firing)
+	}
+	return firings, errs
+}
@@ -0,0 +1,110 @@
+package rules
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewEngineErrors(t *testing.T) {
+	invalidRules := []Rule{
+		{Name: "unknown_action", When: "true", Action: "call"},
+		{Name: "notify_without_message", When: "true", Action: ActionNotify},
+		{Name: "set_mode_without_mode", When: "true", Action: ActionSetMode},
+		{Name: "publish_without_topic", When: "true", Action: ActionPublish},
+		{Name: "not_boolean", When: "hour + 1", Action: ActionSOS},
+		{Name: "unknown_variable", When: "temperature > 30", Action: ActionSOS},
+		{Name: "invalid_message", When: "true", Action: ActionNotify, Message: "{{.Mode"},
+	}
+	for _, rule := range invalidRules {
+		if _, err := NewEngine([]Rule{rule}); err == nil {
+			t.Errorf("Rule %s should fail.", rule.Name)
+		}
+	}
+}
+
+func TestEvaluateFiresOnceWhileMatched(t *testing.T) {
+	engine, err := NewEngine([]Rule{{
+		Name:    "garage_open_at_night",
+		When:    `sensors.garage.activated && sensors.garage.since > duration("10m") && (hour >= 22 || hour < 7)`,
+		Action:  ActionNotify,
+		Message: "{{.Sensors.garage.Name}} open while alarm is {{.Mode}}",
+	}})
+	if err != nil {
+		t.Fatalf("NewEngine should not fail, error was %s", err.Error())
+	}
+	env := NewEnv(time.Date(2024, 5, 3, 23, 0, 0, 0, time.UTC))
+	env.Mode = "home_armed"
+	env.Sensors["garage"] = SensorState{Name: "Garage", Activated: true, Since: 5 * time.Minute}
+
+	if firings, errs := engine.Evaluate("", env); len(firings) != 0 || len(errs) != 0 {
+		t.Errorf("Rule should not fire before 10 minutes. Returned: %v, %v.", firings, errs)
+	}
+	env.Sensors["garage"] = SensorState{Name: "Garage", Activated: true, Since: 11 * time.Minute}
+	firings, errs := engine.Evaluate("", env)
+	if len(firings) != 1 || len(errs) != 0 || firings[0].Message != "Garage open while alarm is home_armed" {
+		t.Errorf("Rule should fire with rendered message. Returned: %v, %v.", firings, errs)
+	}
+	if firings, _ := engine.Evaluate("", env); len(firings) != 0 {
+		t.Errorf("Rule should not fire again while it is matched. Returned: %v.", firings)
+	}
+	env.Sensors["garage"] = SensorState{Name: "Garage"}
+	engine.Evaluate("", env)
+	env.Sensors["garage"] = SensorState{Name: "Garage", Activated: true, Since: 11 * time.Minute}
+	if firings, _ := engine.Evaluate("", env); len(firings) != 1 {
+		t.Errorf("Rule should fire again once it has been unmatched. Returned: %v.", firings)
+	}
+}
+
+func TestEvaluateCooldownAndHistory(t *testing.T) {
+	engine, _ := NewEngine([]Rule{{
+		Name:     "door_opened_repeatedly",
+		When:     `event == "opened" && sensor.name == "door1" && transitions("door1", "5m") >= 3`,
+		Action:   ActionPublish,
+		Topic:    "zigbee2mqtt/siren/set",
+		Payload:  `{"state":"{{.Event}}"}`,
+		Cooldown: time.Hour,
+	}})
+	now := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	env := NewEnv(now)
+	env.Event = "opened"
+	env.Sensor = SensorState{Name: "door1"}
+	env.Transitions = func(sensorName string, window string) int { return 4 }
+
+	firings, errs := engine.Evaluate("", env)
+	if len(firings) != 1 || len(errs) != 0 || firings[0].Payload != `{"state":"opened"}` {
+		t.Fatalf("Rule should fire with rendered payload. Returned: %v, %v.", firings, errs)
+	}
+	env.Event = ""
+	engine.Evaluate("", env)
+	env = NewEnv(now.Add(time.Minute))
+	env.Event = "opened"
+	env.Sensor = SensorState{Name: "door1"}
+	env.Transitions = func(sensorName string, window string) int { return 5 }
+	if firings, _ := engine.Evaluate("", env); len(firings) != 0 {
+		t.Errorf("Rule should not fire during cooldown. Returned: %v.", firings)
+	}
+}
+
+func TestEvaluateEventDrivenRulesSkipPeriodicTicks(t *testing.T) {
+	engine, _ := NewEngine([]Rule{{Name: "hall_activated", When: `sensor.activated && sensor.room == "hall"`, Action: ActionSOS}})
+	now := time.Date(2024, 5, 3, 23, 0, 0, 0, time.UTC)
+	doorEvent := NewEnv(now)
+	doorEvent.Event = "opened"
+	doorEvent.Sensor = SensorState{Name: "door1", Room: "hall", Activated: true}
+	windowEvent := NewEnv(now)
+	windowEvent.Event = "opened"
+	windowEvent.Sensor = SensorState{Name: "window1", Room: "hall", Activated: true}
+
+	if firings, _ := engine.Evaluate("", doorEvent); len(firings) != 1 {
+		t.Errorf("Rule should fire on door1 event. Returned: %v.", firings)
+	}
+	if firings, errs := engine.Evaluate("", NewEnv(now.Add(30*time.Second))); len(firings) != 0 || len(errs) != 0 {
+		t.Errorf("Periodic evaluation should skip event driven rules. Returned: %v, %v.", firings, errs)
+	}
+	if firings, _ := engine.Evaluate("", doorEvent); len(firings) != 0 {
+		t.Errorf("Rule should not fire again on door1 event after a periodic evaluation. Returned: %v.", firings)
+	}
+	if firings, _ := engine.Evaluate("", windowEvent); len(firings) != 1 {
+		t.Errorf("Rule should be matched per sensor. Returned: %v.", firings)
+	}
+}
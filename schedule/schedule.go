@@ -0,0 +1,198 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a daily time window, windows ending before they start finish next day
+type Window struct {
+	Days   [7]bool
+	Start  int
+	End    int
+	AllDay bool
+}
+
+// Schedule is active when any of its windows is, times are evaluated in Location
+type Schedule struct {
+	Expressions []string
+	Windows     []Window
+	Location    *time.Location
+}
+
+// Period is a continuous active time range
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Parse reads window expressions such as "22:00-06:00", "Mon-Fri 08:00-18:00" or "Sat,Sun"
+func Parse(expressions []string, location *time.Location) (*Schedule, error) {
+	if location == nil {
+		location = time.Local
+	}
+	schedule := &Schedule{Expressions: expressions, Location: location}
+	for _, expression := range expressions {
+		window, windowErr := parseWindow(expression)
+		if windowErr != nil {
+			return nil, fmt.Errorf("invalid schedule window %q: %v", expression, windowErr)
+		}
+		schedule.Windows = append(schedule.Windows, window)
+	}
+	if len(schedule.Windows) == 0 {
+		return nil, fmt.Errorf("schedule requires at least one window")
+	}
+	return schedule, nil
+}
+
+func parseWindow(expression string) (Window, error) {
+	var window Window
+	fields := strings.Fields(expression)
+	if len(fields) == 0 || len(fields) > 2 {
+		return window, fmt.Errorf("window must be [days] [HH:MM-HH:MM]")
+	}
+	daysField, timesField := fields[0], ""
+	if len(fields) == 2 {
+		timesField = fields[1]
+	} else if strings.Contains(fields[0], ":") {
+		daysField, timesField = "*", fields[0]
+	}
+
+	if daysErr := parseDays(daysField, &window.Days); daysErr != nil {
+		return window, daysErr
+	}
+	if timesField == "" {
+		window.AllDay = true
+		return window, nil
+	}
+	bounds := strings.Split(timesField, "-")
+	if len(bounds) != 2 {
+		return window, fmt.Errorf("time range must be HH:MM-HH:MM")
+	}
+	var startErr, endErr error
+	window.Start, startErr = parseClock(bounds[0])
+	window.End, endErr = parseClock(bounds[1])
+	if startErr != nil {
+		return window, startErr
+	}
+	if endErr != nil {
+		return window, endErr
+	}
+	if window.Start == window.End {
+		return window, fmt.Errorf("time range start and end must be different")
+	}
+	return window, nil
+}
+
+func parseDays(field string, days *[7]bool) error {
+	if field == "*" {
+		for day := range days {
+			days[day] = true
+		}
+		return nil
+	}
+	for _, dayRange := range strings.Split(strings.ToLower(field), ",") {
+		bounds := strings.Split(dayRange, "-")
+		first, firstFound := weekdays[bounds[0]]
+		last, lastFound := first, firstFound
+		if len(bounds) == 2 {
+			last, lastFound = weekdays[bounds[1]]
+		}
+		if !firstFound || !lastFound || len(bounds) > 2 {
+			return fmt.Errorf("unknown days %q, use Mon, Tue, Wed, Thu, Fri, Sat, Sun, ranges or *", dayRange)
+		}
+		// Ranges may wrap around the week, Fri-Mon included
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock returns minutes since midnight, 24:00 is accepted as end of day
+func parseClock(clock string) (int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("time %q must be HH:MM", clock)
+	}
+	hours, hoursErr := strconv.Atoi(parts[0])
+	minutes, minutesErr := strconv.Atoi(parts[1])
+	if hoursErr != nil || minutesErr != nil || hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("time %q must be HH:MM", clock)
+	}
+	return hours*60 + minutes, nil
+}
+
+// Active returns true if schedule is active at given time, a nil schedule is always active
+func (schedule *Schedule) Active(at time.Time) bool {
+	if schedule == nil {
+		return true
+	}
+	local := at.In(schedule.Location)
+	day := local.Weekday()
+	previousDay := (day + 6) % 7
+	minute := local.Hour()*60 + local.Minute()
+	for _, window := range schedule.Windows {
+		switch {
+		case window.AllDay:
+			if window.Days[day] {
+				return true
+			}
+		case window.Start < window.End:
+			if window.Days[day] && minute >= window.Start && minute < window.End {
+				return true
+			}
+		default:
+			if (window.Days[day] && minute >= window.Start) || (window.Days[previousDay] && minute < window.End) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (schedule *Schedule) String() string {
+	if schedule == nil {
+		return "always"
+	}
+	return strings.Join(schedule.Expressions, ", ") + " (" + schedule.Location.String() + ")"
+}
+
+// Periods returns active periods between from and to with minute resolution
+func Periods(active func(time.Time) bool, from time.Time, to time.Time) []Period {
+	var periods []Period
+	var current *Period
+	for at := from.Truncate(time.Minute); at.Before(to); at = at.Add(time.Minute) {
+		if active(at) {
+			if current == nil {
+				current = &Period{Start: at}
+			}
+			continue
+		}
+		if current != nil {
+			current.End = at
+			periods = append(periods, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		current.End = to
+		periods = append(periods, *current)
+	}
+	return periods
+}
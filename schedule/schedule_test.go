@@ -0,0 +1,71 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, expression := range []string{"", "Mon-Fri 08:00", "Funday 08:00-10:00", "25:00-06:00", "08:00-08:00", "Mon 08:00-10:00 extra"} {
+		if _, err := Parse([]string{expression}, time.UTC); err == nil {
+			t.Errorf("Window %q should fail.", expression)
+		}
+	}
+	if _, err := Parse(nil, time.UTC); err == nil {
+		t.Error("Schedule without windows should fail.")
+	}
+}
+
+func TestActive(t *testing.T) {
+	schedule, err := Parse([]string{"Mon-Fri 22:00-06:00", "Sat,Sun"}, time.UTC)
+	if err != nil {
+		t.Fatalf("Parse should not fail, error was %s", err.Error())
+	}
+	// 2024-05-03 is a Friday
+	cases := map[string]bool{
+		"2024-05-03T21:59:00Z": false,
+		"2024-05-03T22:00:00Z": true,
+		"2024-05-04T05:59:00Z": true,
+		"2024-05-05T12:00:00Z": true,
+		"2024-05-06T05:00:00Z": false,
+		"2024-05-06T06:00:00Z": false,
+		"2024-05-07T03:00:00Z": true,
+	}
+	for at, expected := range cases {
+		parsedTime, _ := time.Parse(time.RFC3339, at)
+		if schedule.Active(parsedTime) != expected {
+			t.Errorf("Schedule active at %s should be %t.", at, expected)
+		}
+	}
+	var noSchedule *Schedule
+	if !noSchedule.Active(time.Now()) {
+		t.Error("Nil schedule should always be active.")
+	}
+}
+
+func TestActiveTimezone(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skip("Europe/Madrid timezone is not available.")
+	}
+	schedule, _ := Parse([]string{"08:00-09:00"}, location)
+	// 08:30 in Madrid summer time is 06:30 UTC
+	if !schedule.Active(time.Date(2024, 7, 1, 6, 30, 0, 0, time.UTC)) {
+		t.Error("Schedule should be evaluated in its timezone.")
+	}
+	if schedule.Active(time.Date(2024, 7, 1, 8, 30, 0, 0, time.UTC)) {
+		t.Error("Schedule should not be active at 08:30 UTC.")
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	schedule, _ := Parse([]string{"Fri-Sun 22:00-06:00"}, time.UTC)
+	from := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	periods := Periods(schedule.Active, from, from.AddDate(0, 0, 3))
+	if len(periods) != 3 {
+		t.Fatalf("Three nights should be active. Returned: %v.", periods)
+	}
+	if !periods[0].Start.Equal(time.Date(2024, 5, 3, 22, 0, 0, 0, time.UTC)) || !periods[0].End.Equal(time.Date(2024, 5, 4, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected first period %v.", periods[0])
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	schedule "github.com/a-castellano/AlarmSensors/schedule"
+)
+
+// sensorScheduled returns true when both sensor and alarm mode schedules are active
+func sensorScheduled(serviceConfig config.Config, sensorName string, mode string, at time.Time) bool {
+	sensor, sensorIsManaged := serviceConfig.Sensors[sensorName]
+	if !sensorIsManaged {
+		return false
+	}
+	return sensor.Schedule.Active(at) && serviceConfig.SensorTriggers[mode].Schedule.Active(at)
+}
+
+func runScheduleCommand(args []string) int {
+	flags := flag.NewFlagSet("schedule", flag.ContinueOnError)
+	configFileLocation := flags.String("config", "", configFlagUsage)
+	mode := flags.String("mode", "", "alarm mode whose schedule is combined with sensor one")
+	days := flags.Int("days", 7, "days to preview")
+	positional, parseErr := parseInterspersed(flags, args)
+	if parseErr != nil {
+		return 2
+	}
+	if len(positional) != 1 || *days <= 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	serviceConfig, errConfig := config.ReadConfigFrom(*configFileLocation)
+	if errConfig != nil {
+		fmt.Fprintln(os.Stderr, errConfig.Error())
+		return 1
+	}
+	sensorName := positional[0]
+	sensor, sensorIsManaged := serviceConfig.Sensors[sensorName]
+	if !sensorIsManaged {
+		fmt.Fprintf(os.Stderr, "Sensor %s is not declared in config.\n", sensorName)
+		return 1
+	}
+	if sensor.Zone == config.ZoneLifeSafety {
+		fmt.Printf("Sensor %s is a 24h zone, it always triggers alarm.\n", sensorName)
+		return 0
+	}
+	if *mode != "" && !sensor.SensorTriggers[*mode] {
+		fmt.Fprintf(os.Stderr, "Sensor %s does not trigger alarm in %s mode.\n", sensorName, *mode)
+		return 1
+	}
+	printSchedulePreview(os.Stdout, serviceConfig, sensorName, *mode, time.Now(), *days)
+	return 0
+}
+
+func printSchedulePreview(out io.Writer, serviceConfig config.Config, sensorName string, mode string, from time.Time, days int) {
+	sensor := serviceConfig.Sensors[sensorName]
+	fmt.Fprintf(out, "Sensor schedule: %s\n", sensor.Schedule)
+	if mode != "" {
+		fmt.Fprintf(out, "Mode %s schedule: %s\n", mode, serviceConfig.SensorTriggers[mode].Schedule)
+	}
+	location := time.Local
+	if sensor.Schedule != nil {
+		location = sensor.Schedule.Location
+	}
+	periods := schedule.Periods(func(at time.Time) bool {
+		if mode == "" {
+			return sensor.Schedule.Active(at)
+		}
+		return sensorScheduled(serviceConfig, sensorName, mode, at)
+	}, from, from.AddDate(0, 0, days))
+
+	fmt.Fprintf(out, "\nActive periods in the next %d days (%s):\n", days, location)
+	if len(periods) == 0 {
+		fmt.Fprintln(out, "  none")
+	}
+	for _, period := range periods {
+		fmt.Fprintf(out, "  %s - %s\n", period.Start.In(location).Format("Mon 2006-01-02 15:04"), period.End.In(location).Format("Mon 2006-01-02 15:04"))
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	alarmmanager "github.com/a-castellano/AlarmSensors/alarmmanager"
+	alarmsensors "github.com/a-castellano/AlarmSensors/alarmsensors"
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	rules "github.com/a-castellano/AlarmSensors/rules"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+)
+
+// messageSender queues notifications, errors only mean event was dropped by full or closed sinks
+// Delivery failures are asynchronous, they are logged by dispatcher and counted in sink metrics
+type messageSender func(event notifier.Event) error
+
+// queueSender sends a message straight to RabbitMQ queue
+type queueSender func(message string, priority uint8) error
+
+// messagePublisher publishes payloads on MQTT topics
+type messagePublisher func(topic string, payload string) error
+
+type service struct {
+	config      config.Config
+	log         *slog.Logger
+	alarm       alarmmanager.Controller
+	router      *alarmsensors.TopicRouter
+	storage     storage.SensorStorage
+	sendFunc    messageSender
+	queueFunc   queueSender
+	publishFunc messagePublisher
+	messages    *notifier.Catalog
+	limiter     *notifier.Limiter
+	debouncer   *alarmsensors.Debouncer
+	ruleEngine  *rules.Engine
+	openAlerts  *openAlerts
+	confirms    *actionConfirmations
+}
+
+// message renders a catalog message, sensor friendly name and room are taken from config
+func (s service) message(messageKey string, data notifier.MessageData) string {
+	if sensor, sensorFound := s.config.Sensors[data.SensorID]; sensorFound {
+		data.Sensor = sensor.FriendlyName
+		data.Room = sensor.Room
+	}
+	return s.messages.Render(messageKey, data)
+}
+
+func (s service) send(event notifier.Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if s.limiter != nil {
+		allowed, expired, limitErr := s.limiter.Allow(context.Background(), event)
+		if limitErr != nil {
+			s.log.Error("Failed to apply notification rate limit.", "error", limitErr)
+		}
+		s.summarize(expired)
+		if !allowed {
+			s.log.Debug("Notification suppressed by rate limit.", "event", event.Type, "sensor", event.Sensor)
+			return
+		}
+	}
+	if sendErr := s.sendFunc(event); sendErr != nil {
+		s.log.Error("Failed to send message.", "error", sendErr)
+	}
+}
+
+func buildTopicRouter(serviceConfig config.Config) (*alarmsensors.TopicRouter, error) {
+	router := alarmsensors.NewTopicRouter()
+	if serviceConfig.Mqtt.WildcardTopic != "" {
+		wildcardPattern, wildcardErr := alarmsensors.WildcardTopicPattern(serviceConfig.Mqtt.WildcardTopic)
+		if wildcardErr != nil {
+			return router, wildcardErr
+		}
+		router.AddRoute(wildcardPattern, "")
+	}
+	for _, topicPattern := range serviceConfig.Mqtt.TopicPatterns {
+		if routeErr := router.AddRoute(topicPattern, ""); routeErr != nil {
+			return router, routeErr
+		}
+	}
+	for sensorName, sensor := range serviceConfig.Sensors {
+		if sensor.Topic != "" {
+			if routeErr := router.AddRoute(sensor.Topic, sensorName); routeErr != nil {
+				return router, routeErr
+			}
+		}
+	}
+	return router, nil
+}
+
+func (s service) handleMessage(ctx context.Context, topic string, message string) {
+
+	if s.config.Zigbee2mqtt.BaseTopic != "" && topic == s.config.Zigbee2mqtt.BaseTopic+"/bridge/state" {
+		s.handleBridgeState(ctx, message)
+		return
+	}
+	if s.config.Bypass.CommandTopic != "" && topic == s.config.Bypass.CommandTopic {
+		s.handleBypassCommand(ctx, message)
+		return
+	}
+
+	topicMatch, routed := s.router.Route(topic)
+	if !routed {
+		return
+	}
+	candidateSensor := topicMatch.Sensor
+	if _, sensorIsManaged := s.config.Sensors[candidateSensor]; !sensorIsManaged {
+		return
+	}
+	if topicMatch.Kind == alarmsensors.TopicAvailability {
+		s.handleAvailability(ctx, candidateSensor, message)
+		return
+	}
+	// Only state topics carry sensor values, command topics are ignored
+	if topicMatch.Kind != alarmsensors.TopicState {
+		return
+	}
+
+	sensor := s.config.Sensors[candidateSensor]
+	sensorLog := s.log.With("sensor", candidateSensor, "topic", topic, "device", sensor.Device)
+	// Receiving sensor state means it is online again
+	if backOnline, _ := s.storage.UpdateAvailability(ctx, candidateSensor, true); backOnline {
+		onlineMessage := s.message(notifier.MessageSensorOnline, notifier.MessageData{SensorID: candidateSensor})
+		sensorLog.Info(onlineMessage)
+		s.send(notifier.Event{Type: notifier.EventSensorAvailability, Message: onlineMessage, Priority: normalPriority, Sensor: candidateSensor, Device: sensor.Device})
+	}
+	sensorValue, valueFound, decodeErr := alarmsensors.DecodeSensorValue(message, sensor.Type)
+	if decodeErr != nil {
+		sensorLog.Error("Failed to check sensor payload.", "error", decodeErr)
+		return
+	}
+	if !valueFound {
+		return
+	}
+	// Actions are events, they are neither stored nor debounced
+	if sensorValue.Kind == alarmsensors.KindAction {
+		s.handleAction(ctx, sensorLog, candidateSensor, sensorValue.Action)
+		return
+	}
+	if s.debouncer == nil {
+		s.handleSensorValue(ctx, sensorLog, candidateSensor, sensorValue)
+		return
+	}
+	// Debounced values are handled once they have persisted
+	s.debouncer.Submit(candidateSensor, sensorValue, sensor.Debounce, func(debouncedValue alarmsensors.SensorValue) {
+		s.handleSensorValue(ctx, sensorLog, candidateSensor, debouncedValue)
+	})
+}
+
+// handleSensorValue stores sensor value and triggers alarm when sensor is activated in a triggering mode
+func (s service) handleSensorValue(ctx context.Context, sensorLog *slog.Logger, candidateSensor string, sensorValue alarmsensors.SensorValue) {
+	sensor := s.config.Sensors[candidateSensor]
+	// Left open follow-ups need the time sensor was opened
+	var previousStatus storage.SensorStatus
+	if sensor.MaxOpenDuration > 0 {
+		previousStatus, _, _ = s.storage.GetSensorStatus(ctx, candidateSensor)
+	}
+	changed, sensorState, sensorActivated, checkSensorErr := alarmsensors.ApplySensorValue(ctx, candidateSensor, sensorValue, s.storage)
+	if checkSensorErr != nil {
+		sensorLog.Error("Failed to store sensor value.", "error", checkSensorErr)
+	} else {
+		sensorLog.Debug("Sensor payload processed.", "changed", changed, "activated", sensorActivated)
+		// Check alarm status
+		if changed == true {
+			statusMessage := s.message("sensor_status."+sensorState, notifier.MessageData{SensorID: candidateSensor, Device: sensor.Device})
+			sensorLog.Info(statusMessage)
+			now := time.Now()
+			s.recordTransition(ctx, sensorLog, candidateSensor, now)
+			flapping := s.checkFlapping(ctx, sensorLog, candidateSensor, now)
+			if sensor.MaxOpenDuration > 0 && sensorValue.Kind == alarmsensors.KindContact {
+				s.trackOpenSensor(ctx, sensorLog, candidateSensor, sensorActivated, previousStatus, now)
+			}
+			if sensorActivated == true && sensor.Zone == config.ZoneLifeSafety {
+				s.triggerLifeSafety(ctx, sensorLog, candidateSensor, sensorState)
+			} else if sensorActivated == true {
+				currentAlarmMode, modeErr := s.alarm.CurrentMode(sensor.Device)
+				if modeErr != nil {
+					// Never drop an activation silently
+					logMessage := s.message(notifier.MessageAlarmStatusUnknown, notifier.MessageData{SensorID: candidateSensor, Device: sensor.Device})
+					sensorLog.Error(logMessage, "error", modeErr)
+					s.send(notifier.Event{Type: notifier.EventAlarmStatusUnknown, Message: logMessage, Priority: highPriority, Sensor: candidateSensor, Device: sensor.Device})
+				} else {
+					sensorLog = sensorLog.With("mode", currentAlarmMode)
+					// Check if sensor triggers alarm
+					_, triggerAlarm := sensor.SensorTriggers[currentAlarmMode]
+					scheduled := sensorScheduled(s.config, candidateSensor, currentAlarmMode, now)
+					bypassed := false
+					if triggerAlarm && scheduled {
+						var bypassErr error
+						if _, bypassed, bypassErr = s.storage.GetBypass(ctx, candidateSensor); bypassErr != nil {
+							sensorLog.Error("Failed to read sensor bypass.", "error", bypassErr)
+						}
+					}
+					if triggerAlarm && !scheduled {
+						logMessage := s.message(notifier.MessageTriggerUnscheduled, notifier.MessageData{SensorID: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+						sensorLog.Info(logMessage)
+						s.send(notifier.Event{Type: notifier.EventTriggerIgnored, Message: logMessage, Priority: normalPriority, Sensor: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+					} else if triggerAlarm && bypassed {
+						logMessage := s.message(notifier.MessageTriggerBypassed, notifier.MessageData{SensorID: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+						sensorLog.Warn(logMessage)
+						s.send(notifier.Event{Type: notifier.EventTriggerIgnored, Message: logMessage, Priority: normalPriority, Sensor: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+					} else if triggerAlarm && flapping && s.config.Flapping.Bypass {
+						logMessage := s.message(notifier.MessageTriggerFlapping, notifier.MessageData{SensorID: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+						sensorLog.Warn(logMessage)
+						s.send(notifier.Event{Type: notifier.EventTriggerIgnored, Message: logMessage, Priority: normalPriority, Sensor: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+					} else if triggerAlarm && s.config.DryRun {
+						// Dry run replaces alarm trigger notification, it must not look like a real alarm
+						logMessage := s.message(notifier.MessageDryRunTriggered, notifier.MessageData{SensorID: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+						sensorLog.Warn(logMessage)
+						s.send(notifier.Event{Type: notifier.EventDryRun, Message: logMessage, Priority: normalPriority, Sensor: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+						s.triggerSOS(ctx, sensorLog, candidateSensor, sensor.Device, currentAlarmMode)
+					} else if triggerAlarm {
+						logMessage := s.message(notifier.MessageAlarmTriggered, notifier.MessageData{SensorID: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+						sensorLog.Warn(logMessage)
+						s.send(notifier.Event{Type: notifier.EventAlarmTriggered, Message: logMessage, Priority: highPriority, Sensor: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+						s.triggerSOS(ctx, sensorLog, candidateSensor, sensor.Device, currentAlarmMode)
+					} else {
+						logMessage := s.message(notifier.MessageTriggerIgnored, notifier.MessageData{SensorID: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+						sensorLog.Info(logMessage)
+						s.send(notifier.Event{Type: notifier.EventTriggerIgnored, Message: logMessage, Priority: normalPriority, Sensor: candidateSensor, Device: sensor.Device, Mode: currentAlarmMode})
+					}
+				}
+			} else {
+				s.send(notifier.Event{Type: notifier.EventSensorStatus, Message: statusMessage, Priority: normalPriority, Sensor: candidateSensor, Device: sensor.Device})
+			}
+			s.evaluateRules(ctx, candidateSensor, sensorState)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	alarmmanager "github.com/a-castellano/AlarmSensors/alarmmanager"
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	notifier "github.com/a-castellano/AlarmSensors/notifier"
+	storage "github.com/a-castellano/AlarmSensors/storage"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v3"
+)
+
+type timelineStep struct {
+	Topic   string      `yaml:"topic" json:"topic"`
+	Payload interface{} `yaml:"payload" json:"payload"`
+	Delay   string      `yaml:"delay" json:"delay"`
+	Mode    string      `yaml:"mode" json:"mode"`
+}
+
+// simulationLogWriter indents service logs in simulation output
+type simulationLogWriter struct {
+	out io.Writer
+}
+
+func (writer simulationLogWriter) Write(line []byte) (int, error) {
+	_, err := fmt.Fprintf(writer.out, "    %s", line)
+	return len(line), err
+}
+
+// simulatedController replaces alarmManager, every device is in the assumed mode
+type simulatedController struct {
+	mutex    sync.Mutex
+	out      io.Writer
+	mode     string
+	sosCalls int
+}
+
+func (controller *simulatedController) CurrentMode(deviceID string) (string, error) {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+	return controller.mode, nil
+}
+
+func (controller *simulatedController) SetMode(deviceID string, mode string) error {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+	if mode == alarmmanager.SOSMode {
+		controller.sosCalls++
+		fmt.Fprintf(controller.out, "  SOS CALL: device %s\n", deviceID)
+	} else {
+		fmt.Fprintf(controller.out, "  MODE CHANGE: device %s set to %s\n", deviceID, mode)
+	}
+	controller.mode = mode
+	return nil
+}
+
+func (controller *simulatedController) setAssumedMode(mode string) {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+	controller.mode = mode
+}
+
+func readTimeline(timelineFile string) ([]timelineStep, error) {
+	var steps []timelineStep
+	timelineContent, readErr := os.ReadFile(timelineFile)
+	if readErr != nil {
+		return steps, readErr
+	}
+	extension := strings.ToLower(filepath.Ext(timelineFile))
+	if extension == ".jsonl" || extension == ".json" {
+		scanner := bufio.NewScanner(strings.NewReader(string(timelineContent)))
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			var step timelineStep
+			if err := json.Unmarshal([]byte(line), &step); err != nil {
+				return steps, fmt.Errorf("timeline line %d: %v", lineNumber, err)
+			}
+			steps = append(steps, step)
+		}
+		return steps, scanner.Err()
+	}
+	if err := yaml.Unmarshal(timelineContent, &steps); err != nil {
+		return steps, err
+	}
+	return steps, nil
+}
+
+// stepPayload returns payload as received from MQTT, structured payloads are encoded as JSON
+func stepPayload(step timelineStep) (string, error) {
+	switch payload := step.Payload.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return payload, nil
+	default:
+		encodedPayload, err := json.Marshal(payload)
+		return string(encodedPayload), err
+	}
+}
+
+func runSimulate(args []string) int {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	timelineFile := flags.String("timeline", "", "YAML or JSONL file with topic, payload, delay and mode steps")
+	assumedMode := flags.String("mode", "", "alarm mode assumed when simulation starts")
+	speed := flags.Float64("speed", 1, "delays are divided by this factor")
+	configFileLocation := flags.String("config", "", configFlagUsage)
+	verbose := flags.Bool("verbose", false, "show debug logs")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *timelineFile == "" || *assumedMode == "" {
+		fmt.Fprintln(os.Stderr, "simulate requires -timeline and -mode flags.")
+		flags.Usage()
+		return 2
+	}
+	if *speed <= 0 {
+		fmt.Fprintln(os.Stderr, "simulate -speed must be greater than 0.")
+		return 2
+	}
+
+	serviceConfig, errConfig := config.ReadConfigFrom(*configFileLocation)
+	if errConfig != nil {
+		fmt.Fprintln(os.Stderr, errConfig.Error())
+		return 1
+	}
+	steps, timelineErr := readTimeline(*timelineFile)
+	if timelineErr != nil {
+		fmt.Fprintln(os.Stderr, timelineErr.Error())
+		return 1
+	}
+
+	if err := simulate(os.Stdout, serviceConfig, steps, *assumedMode, *speed, *verbose); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	return 0
+}
+
+func simulate(out io.Writer, serviceConfig config.Config, steps []timelineStep, assumedMode string, speed float64, verbose bool) error {
+	router, routerErr := buildTopicRouter(serviceConfig)
+	if routerErr != nil {
+		return routerErr
+	}
+	logLevel := slog.LevelInfo
+	if verbose {
+		logLevel = slog.LevelDebug
+	}
+	log := slog.New(slog.NewTextHandler(simulationLogWriter{out: out}, &slog.HandlerOptions{Level: logLevel, ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+		// Simulation steps already show elapsed time
+		if attr.Key == slog.TimeKey && len(groups) == 0 {
+			return slog.Attr{}
+		}
+		return attr
+	}}))
+	messages, messagesErr := notifier.NewCatalog(serviceConfig.Messages.Locale, serviceConfig.Messages.Templates)
+	if messagesErr != nil {
+		return messagesErr
+	}
+	ruleEngine, rulesErr := newRuleEngine(serviceConfig)
+	if rulesErr != nil {
+		return rulesErr
+	}
+	memoryStorage := storage.NewMemoryStorage()
+	controller := &simulatedController{out: out, mode: assumedMode}
+	notifications := 0
+	simulationService := service{
+		config:  serviceConfig,
+		log:     log,
+		alarm:   controller,
+		router:  router,
+		storage: memoryStorage,
+		sendFunc: func(event notifier.Event) error {
+			notifications++
+			if event.Priority >= highPriority {
+				fmt.Fprintf(out, "  NOTIFICATION (high priority): %s\n", event.Message)
+			} else {
+				fmt.Fprintf(out, "  NOTIFICATION: %s\n", event.Message)
+			}
+			return nil
+		},
+		publishFunc: func(topic string, payload string) error {
+			fmt.Fprintf(out, "  MQTT PUBLISH: %s %s\n", topic, payload)
+			return nil
+		},
+		messages:   messages,
+		limiter:    newLimiter(serviceConfig, memoryStorage),
+		ruleEngine: ruleEngine,
+		confirms:   newActionConfirmations(),
+	}
+
+	ctx := context.Background()
+	var elapsed time.Duration
+	fmt.Fprintf(out, "Simulation started, alarm mode is %s.\n", assumedMode)
+	for index, step := range steps {
+		if step.Delay != "" {
+			delay, delayErr := time.ParseDuration(step.Delay)
+			if delayErr != nil {
+				return fmt.Errorf("timeline step %d: %v", index+1, delayErr)
+			}
+			elapsed += delay
+			time.Sleep(time.Duration(float64(delay) / speed))
+		}
+		if step.Mode != "" {
+			controller.setAssumedMode(step.Mode)
+			fmt.Fprintf(out, "[+%s] alarm mode is now %s\n", elapsed, step.Mode)
+		}
+		if step.Topic == "" {
+			if step.Mode == "" {
+				return fmt.Errorf("timeline step %d has no topic nor mode", index+1)
+			}
+			continue
+		}
+		payload, payloadErr := stepPayload(step)
+		if payloadErr != nil {
+			return fmt.Errorf("timeline step %d: %v", index+1, payloadErr)
+		}
+		fmt.Fprintf(out, "[+%s] %s %s\n", elapsed, step.Topic, payload)
+		simulationService.handleMessage(ctx, step.Topic, payload)
+	}
+	fmt.Fprintf(out, "Simulation finished: %d notifications, %d SOS calls.\n", notifications, controller.sosCalls)
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/a-castellano/AlarmSensors/config_reader"
+	rules "github.com/a-castellano/AlarmSensors/rules"
+	schedule "github.com/a-castellano/AlarmSensors/schedule"
+)
+
+func readTestConfig(t *testing.T) config.Config {
+	os.Setenv("ALARM_SENSORS_CONFIG_FILE_LOCATION", "./config_reader/config_files_test/config_ok/")
+	serviceConfig, err := config.ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig should not fail, error was %s", err.Error())
+	}
+	return serviceConfig
+}
+
+func TestReadTimelineJSONL(t *testing.T) {
+	timelineFile := filepath.Join(t.TempDir(), "timeline.jsonl")
+	timeline := `{"topic":"sensor/door1","payload":{"contact":false},"delay":"1s"}
+
+{"mode":"disarmed"}
+`
+	os.WriteFile(timelineFile, []byte(timeline), 0644)
+
+	steps, err := readTimeline(timelineFile)
+	if err != nil {
+		t.Fatalf("readTimeline should not fail, error was %s", err.Error())
+	}
+	if len(steps) != 2 {
+		t.Fatalf("Timeline should have 2 steps. Returned: %d.", len(steps))
+	}
+	payload, _ := stepPayload(steps[0])
+	if payload != `{"contact":false}` {
+		t.Errorf("Unexpected payload %s.", payload)
+	}
+	if steps[1].Mode != "disarmed" {
+		t.Errorf("Second step mode should be disarmed. Returned: %s.", steps[1].Mode)
+	}
+}
+
+func TestSimulateTriggersSOS(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	steps := []timelineStep{
+		{Topic: "sensor/door1", Payload: `{"contact":true}`},
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+		{Mode: "disarmed"},
+		{Topic: "sensor/motion1", Payload: `{"occupancy":true}`},
+	}
+	var out bytes.Buffer
+	if err := simulate(&out, serviceConfig, steps, "armed", 1, false); err != nil {
+		t.Fatalf("simulate should not fail, error was %s", err.Error())
+	}
+	if strings.Count(out.String(), "SOS CALL: device 1") != 1 {
+		t.Errorf("Simulation should fire exactly one SOS call. Output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "NOTIFICATION (high priority): door1 sensor has been triggered") {
+		t.Errorf("Alarm trigger should be notified with high priority. Output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Simulation finished: 3 notifications, 1 SOS calls.") {
+		t.Errorf("Unexpected simulation summary. Output:\n%s", out.String())
+	}
+}
+
+func TestSimulateDryRun(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	serviceConfig.DryRun = true
+	steps := []timelineStep{
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+	}
+	var out bytes.Buffer
+	if err := simulate(&out, serviceConfig, steps, "armed", 1, false); err != nil {
+		t.Fatalf("simulate should not fail, error was %s", err.Error())
+	}
+	if !strings.Contains(out.String(), "NOTIFICATION: DRY RUN - door1 sensor has been triggered and alarm status is armed, alarm would be triggered.") {
+		t.Errorf("Alarm trigger should be notified as dry run. Output:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "triggering alarm") {
+		t.Errorf("Regular alarm trigger notification should not be sent in dry run. Output:\n%s", out.String())
+	}
+}
+
+func TestSimulateLocalizedMessages(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	serviceConfig.Messages.Locale = "es"
+	serviceConfig.Sensors["door1"].FriendlyName = "Puerta principal"
+	steps := []timelineStep{
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+	}
+	var out bytes.Buffer
+	if err := simulate(&out, serviceConfig, steps, "disarmed", 1, false); err != nil {
+		t.Fatalf("simulate should not fail, error was %s", err.Error())
+	}
+	if !strings.Contains(out.String(), "NOTIFICATION: Se ha activado el sensor Puerta principal pero la alarma está en modo disarmed, NO se dispara la alarma.") {
+		t.Errorf("Notification should be localized and use friendly name. Output:\n%s", out.String())
+	}
+}
+
+func TestSimulateRateLimit(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	serviceConfig.RateLimit.MaxEvents = 1
+	steps := []timelineStep{
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+		{Topic: "sensor/door1", Payload: `{"contact":true}`},
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+		{Topic: "sensor/door1", Payload: `{"contact":true}`},
+		{Mode: "armed"},
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+	}
+	var out bytes.Buffer
+	if err := simulate(&out, serviceConfig, steps, "disarmed", 1, false); err != nil {
+		t.Fatalf("simulate should not fail, error was %s", err.Error())
+	}
+	// Only first notification of each event type passes, alarm trigger always passes
+	if !strings.Contains(out.String(), "Simulation finished: 3 notifications, 1 SOS calls.") {
+		t.Errorf("Unexpected simulation summary. Output:\n%s", out.String())
+	}
+}
+
+func TestSimulateFlappingBypass(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	serviceConfig.Flapping.MaxTransitions = 2
+	serviceConfig.Flapping.Bypass = true
+	steps := []timelineStep{
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+		{Topic: "sensor/door1", Payload: `{"contact":true}`},
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+	}
+	var out bytes.Buffer
+	if err := simulate(&out, serviceConfig, steps, "armed", 1, false); err != nil {
+		t.Fatalf("simulate should not fail, error was %s", err.Error())
+	}
+	if !strings.Contains(out.String(), "NOTIFICATION (high priority): Sensor 'door1' is flapping, it changed 3 times in the last 1m.") {
+		t.Errorf("Flapping trouble notification should be sent. Output:\n%s", out.String())
+	}
+	if strings.Count(out.String(), "SOS CALL") != 1 {
+		t.Errorf("Flapping sensor should not trigger alarm again. Output:\n%s", out.String())
+	}
+}
+
+func TestSimulateBypassCommand(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	serviceConfig.Bypass.CommandTopic = "alarmsensors/bypass/set"
+	steps := []timelineStep{
+		{Topic: "alarmsensors/bypass/set", Payload: `{"sensor":"door1","until_disarm":true}`},
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+	}
+	var out bytes.Buffer
+	if err := simulate(&out, serviceConfig, steps, "armed", 1, false); err != nil {
+		t.Fatalf("simulate should not fail, error was %s", err.Error())
+	}
+	if !strings.Contains(out.String(), "NOTIFICATION: Sensor 'door1' is bypassed until next disarm.") {
+		t.Errorf("Bypass notification should be sent. Output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Simulation finished: 2 notifications, 0 SOS calls.") {
+		t.Errorf("Bypassed sensor should not trigger alarm. Output:\n%s", out.String())
+	}
+}
+
+func TestSimulateOutsideSchedule(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	// Window starts in two hours, sensor is never active during simulation
+	now := time.Now().UTC()
+	window := fmt.Sprintf("%s-%s", now.Add(2*time.Hour).Format("15:04"), now.Add(3*time.Hour).Format("15:04"))
+	doorSchedule, err := schedule.Parse([]string{window}, time.UTC)
+	if err != nil {
+		t.Fatalf("Parse should not fail, error was %s", err.Error())
+	}
+	serviceConfig.Sensors["door1"].Schedule = doorSchedule
+	steps := []timelineStep{
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+	}
+	var out bytes.Buffer
+	if err := simulate(&out, serviceConfig, steps, "armed", 1, false); err != nil {
+		t.Fatalf("simulate should not fail, error was %s", err.Error())
+	}
+	if !strings.Contains(out.String(), "door1 sensor has been triggered and alarm status is armed but sensor is outside its schedule") {
+		t.Errorf("Trigger outside schedule should be ignored. Output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "0 SOS calls") {
+		t.Errorf("Sensor outside schedule should not trigger alarm. Output:\n%s", out.String())
+	}
+}
+
+func TestSimulateRules(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	serviceConfig.Rules = []rules.Rule{
+		{Name: "door_opened_repeatedly", When: `event == "opened" && transitions(sensor.name, "5m") >= 3`, Action: rules.ActionPublish, Device: "1", Topic: "zigbee2mqtt/siren/set", Payload: `{"sensor":"{{.Sensor.Name}}"}`},
+		{Name: "motion_while_disarmed", When: `mode == "disarmed" && sensors.motion1.activated`, Action: rules.ActionNotify, Device: "1", Message: "Motion detected while alarm is {{.Mode}}."},
+	}
+	steps := []timelineStep{
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+		{Topic: "sensor/door1", Payload: `{"contact":true}`},
+		{Topic: "sensor/door1", Payload: `{"contact":false}`},
+		{Topic: "sensor/motion1", Payload: `{"occupancy":true}`},
+	}
+	var out bytes.Buffer
+	if err := simulate(&out, serviceConfig, steps, "disarmed", 1, false); err != nil {
+		t.Fatalf("simulate should not fail, error was %s", err.Error())
+	}
+	if strings.Count(out.String(), `MQTT PUBLISH: zigbee2mqtt/siren/set {"sensor":"door1"}`) != 1 {
+		t.Errorf("Publish rule should fire once on third transition. Output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "NOTIFICATION: Motion detected while alarm is disarmed.") {
+		t.Errorf("Notify rule should fire. Output:\n%s", out.String())
+	}
+}
+
+func TestSimulateLifeSafety(t *testing.T) {
+	serviceConfig := readTestConfig(t)
+	serviceConfig.Sensors["door1"].Zone = config.ZoneLifeSafety
+	serviceConfig.Sensors["door1"].AlarmMode = "FIRE"
+	serviceConfig.Sensors["door1"].SensorTriggers = map[string]bool{}
+	steps := []timelineStep{
+		{Topic: "sensor/door1", Payload: `{"smoke":false}`},
+		{Topic: "sensor/door1", Payload: `{"smoke":true}`},
+	}
+	var out bytes.Buffer
+	if err := simulate(&out, serviceConfig, steps, "disarmed", 1, false); err != nil {
+		t.Fatalf("simulate should not fail, error was %s", err.Error())
+	}
+	if !strings.Contains(out.String(), "MODE CHANGE: device 1 set to FIRE") || strings.Contains(out.String(), "SOS CALL") {
+		t.Errorf("Smoke should set FIRE mode while alarm is disarmed. Output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "NOTIFICATION (high priority): EMERGENCY - Smoke detected by door1, alarm status is set to FIRE.") {
+		t.Errorf("Smoke should be notified with high priority. Output:\n%s", out.String())
+	}
+}
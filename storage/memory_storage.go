@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps sensors status in memory, it is used by simulations
+type MemoryStorage struct {
+	mutex   sync.Mutex
+	sensors map[string]SensorStatus
+	bridges map[string]bool
+	modes   map[string]string
+	windows map[string]NotificationWindow
+	// transitions are kept sorted by time
+	transitions map[string][]time.Time
+	bypasses    map[string]Bypass
+	// SOSFailures keeps every recorded SOS failure
+	SOSFailures []SOSFailure
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{sensors: make(map[string]SensorStatus), bridges: make(map[string]bool), modes: make(map[string]string), windows: make(map[string]NotificationWindow), transitions: make(map[string][]time.Time), bypasses: make(map[string]Bypass)}
+}
+
+func (storage *MemoryStorage) UpdateAndNotify(ctx context.Context, sensorName string, sensorValue bool) (bool, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	sensorStatus, found := storage.sensors[sensorName]
+	changed := !found || sensorStatus.Triggered != sensorValue
+	sensorStatus.Name = sensorName
+	sensorStatus.Triggered = sensorValue
+	sensorStatus.LastUpdated = time.Now().Unix()
+	storage.sensors[sensorName] = sensorStatus
+	return changed, nil
+}
+
+func (storage *MemoryStorage) SetActivated(ctx context.Context, sensorName string, kind string, activated bool, at time.Time) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	sensorStatus := storage.sensors[sensorName]
+	sensorStatus.Name = sensorName
+	sensorStatus.Activated = activated
+	sensorStatus.ChangedAt = at.Unix()
+	sensorStatus.Kind = kind
+	storage.sensors[sensorName] = sensorStatus
+	return nil
+}
+
+func (storage *MemoryStorage) GetSensorStatus(ctx context.Context, sensorName string) (SensorStatus, bool, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	sensorStatus, found := storage.sensors[sensorName]
+	return sensorStatus, found, nil
+}
+
+func (storage *MemoryStorage) UpdateAvailability(ctx context.Context, sensorName string, online bool) (bool, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	sensorStatus, found := storage.sensors[sensorName]
+	if sensorStatus.Offline != online {
+		return false, nil
+	}
+	// Like Redis storage, availability is only stored once sensor has sent a value
+	if !found {
+		return true, nil
+	}
+	sensorStatus.Name = sensorName
+	sensorStatus.Offline = !online
+	storage.sensors[sensorName] = sensorStatus
+	return true, nil
+}
+
+func (storage *MemoryStorage) UpdateBridgeAvailability(ctx context.Context, bridgeName string, online bool) (bool, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	offline := storage.bridges[bridgeName]
+	if offline != online {
+		return false, nil
+	}
+	storage.bridges[bridgeName] = !online
+	return true, nil
+}
+
+func (storage *MemoryStorage) ResetSensorStatus(ctx context.Context, sensorName string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	delete(storage.sensors, sensorName)
+	delete(storage.transitions, sensorName)
+	return nil
+}
+
+func (storage *MemoryStorage) StoreAlarmMode(ctx context.Context, deviceID string, mode string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.modes[deviceID] = mode
+	return nil
+}
+
+func (storage *MemoryStorage) GetAlarmMode(ctx context.Context, deviceID string) (string, bool, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	mode, found := storage.modes[deviceID]
+	return mode, found, nil
+}
+
+func (storage *MemoryStorage) RecordSOSFailure(ctx context.Context, failure SOSFailure) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.SOSFailures = append(storage.SOSFailures, failure)
+	return nil
+}
+
+func (storage *MemoryStorage) GetNotificationWindow(ctx context.Context, key string) (NotificationWindow, bool, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	window, found := storage.windows[key]
+	return window, found, nil
+}
+
+func (storage *MemoryStorage) StoreNotificationWindow(ctx context.Context, key string, window NotificationWindow) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.windows[key] = window
+	return nil
+}
+
+func (storage *MemoryStorage) NotificationWindowKeys(ctx context.Context) ([]string, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	var keys []string
+	for key := range storage.windows {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (storage *MemoryStorage) DeleteNotificationWindow(ctx context.Context, key string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	delete(storage.windows, key)
+	return nil
+}
+
+func (storage *MemoryStorage) RecordTransition(ctx context.Context, sensorName string, at time.Time, keep time.Duration) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	var kept []time.Time
+	for _, transition := range append(storage.transitions[sensorName], at) {
+		if !transition.Before(at.Add(-keep)) {
+			kept = append(kept, transition)
+		}
+	}
+	storage.transitions[sensorName] = kept
+	return nil
+}
+
+func (storage *MemoryStorage) CountTransitions(ctx context.Context, sensorName string, since time.Time) (int64, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	var count int64
+	for _, transition := range storage.transitions[sensorName] {
+		if !transition.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (storage *MemoryStorage) SetFlapping(ctx context.Context, sensorName string, flapping bool) (bool, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	sensorStatus := storage.sensors[sensorName]
+	if sensorStatus.Flapping == flapping {
+		return false, nil
+	}
+	sensorStatus.Name = sensorName
+	sensorStatus.Flapping = flapping
+	storage.sensors[sensorName] = sensorStatus
+	return true, nil
+}
+
+func (storage *MemoryStorage) SetOpenAlert(ctx context.Context, sensorName string, at time.Time) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	sensorStatus := storage.sensors[sensorName]
+	sensorStatus.Name = sensorName
+	sensorStatus.OpenAlertAt = at.Unix()
+	storage.sensors[sensorName] = sensorStatus
+	return nil
+}
+
+func (storage *MemoryStorage) SetBypass(ctx context.Context, bypass Bypass) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	storage.bypasses[bypass.Sensor] = bypass
+	return nil
+}
+
+func (storage *MemoryStorage) GetBypass(ctx context.Context, sensorName string) (Bypass, bool, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	bypass, found := storage.bypasses[sensorName]
+	return bypass, found && bypass.Active(time.Now()), nil
+}
+
+func (storage *MemoryStorage) ListBypasses(ctx context.Context) ([]Bypass, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	var bypasses []Bypass
+	for _, bypass := range storage.bypasses {
+		if bypass.Active(time.Now()) {
+			bypasses = append(bypasses, bypass)
+		}
+	}
+	sort.Slice(bypasses, func(i, j int) bool { return bypasses[i].Sensor < bypasses[j].Sensor })
+	return bypasses, nil
+}
+
+func (storage *MemoryStorage) ClearBypass(ctx context.Context, sensorName string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+	delete(storage.bypasses, sensorName)
+	return nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorageUpdateAndNotify(t *testing.T) {
+	storageInstance := NewMemoryStorage()
+	var ctx = context.TODO()
+
+	changed, _ := storageInstance.UpdateAndNotify(ctx, "door1", true)
+	if changed != true {
+		t.Error("TestMemoryStorageUpdateAndNotify, changed should be true as no previous record was stored.")
+	}
+	changed, _ = storageInstance.UpdateAndNotify(ctx, "door1", true)
+	if changed != false {
+		t.Error("TestMemoryStorageUpdateAndNotify, changed should be false as value is the same.")
+	}
+	changed, _ = storageInstance.UpdateAndNotify(ctx, "door1", false)
+	if changed != true {
+		t.Error("TestMemoryStorageUpdateAndNotify, changed should be true as value has changed.")
+	}
+	sensorStatus, found, _ := storageInstance.GetSensorStatus(ctx, "door1")
+	if !found || sensorStatus.Triggered != false {
+		t.Errorf("TestMemoryStorageUpdateAndNotify, unexpected stored status %+v.", sensorStatus)
+	}
+}
+
+func TestMemoryStorageAvailability(t *testing.T) {
+	storageInstance := NewMemoryStorage()
+	var ctx = context.TODO()
+
+	if changed, _ := storageInstance.UpdateAvailability(ctx, "door1", true); changed {
+		t.Error("TestMemoryStorageAvailability, unknown sensors are online.")
+	}
+	if changed, _ := storageInstance.UpdateAvailability(ctx, "door1", false); !changed {
+		t.Error("TestMemoryStorageAvailability, changed should be true when sensor goes offline.")
+	}
+	if _, found, _ := storageInstance.GetSensorStatus(ctx, "door1"); found {
+		t.Error("TestMemoryStorageAvailability, availability should not be stored before sensor sends a value.")
+	}
+	storageInstance.UpdateAndNotify(ctx, "door1", true)
+	if changed, _ := storageInstance.UpdateAvailability(ctx, "door1", false); !changed {
+		t.Error("TestMemoryStorageAvailability, changed should be true when stored sensor goes offline.")
+	}
+	if sensorStatus, _, _ := storageInstance.GetSensorStatus(ctx, "door1"); !sensorStatus.Offline || !sensorStatus.Triggered {
+		t.Errorf("TestMemoryStorageAvailability, offline flag should be added to stored status %+v.", sensorStatus)
+	}
+	if changed, _ := storageInstance.UpdateBridgeAvailability(ctx, "zigbee2mqtt", false); !changed {
+		t.Error("TestMemoryStorageAvailability, changed should be true when bridge goes offline.")
+	}
+}
+
+func TestMemoryStorageTransitions(t *testing.T) {
+	storageInstance := NewMemoryStorage()
+	var ctx = context.TODO()
+
+	start := time.Unix(1000, 0)
+	for i := 0; i < 5; i++ {
+		storageInstance.RecordTransition(ctx, "door1", start.Add(time.Duration(i)*time.Minute), 3*time.Minute)
+	}
+	if count, _ := storageInstance.CountTransitions(ctx, "door1", start); count != 4 {
+		t.Errorf("TestMemoryStorageTransitions, transitions older than 3 minutes should be removed. Count: %d.", count)
+	}
+	if count, _ := storageInstance.CountTransitions(ctx, "door1", start.Add(3*time.Minute)); count != 2 {
+		t.Errorf("TestMemoryStorageTransitions, 2 transitions should be counted. Count: %d.", count)
+	}
+	if changed, _ := storageInstance.SetFlapping(ctx, "door1", true); changed != true {
+		t.Error("TestMemoryStorageTransitions, flapping flag should change.")
+	}
+	if sensorStatus, _, _ := storageInstance.GetSensorStatus(ctx, "door1"); sensorStatus.Flapping != true {
+		t.Error("TestMemoryStorageTransitions, sensor should be flapping.")
+	}
+}
@@ -2,6 +2,9 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
 	"time"
 
 	goredis "github.com/go-redis/redis/v8"
@@ -11,8 +14,49 @@ type SensorStatus struct {
 	Name        string `redis:"name"`
 	LastUpdated int64  `redis:"lastupdated"`
 	Triggered   bool   `redis:"triggered"`
+	Offline     bool   `redis:"offline"`
+	Flapping    bool   `redis:"flapping"`
+	// Activated is true while sensor is open or detecting motion, ChangedAt is its last change
+	Activated bool  `redis:"activated"`
+	ChangedAt int64 `redis:"changedat"`
+	// Kind is the payload key of last value, such as contact or occupancy
+	Kind string `redis:"kind"`
+	// OpenAlertAt is when last left open alert was sent
+	OpenAlertAt int64 `redis:"openalertat"`
 }
 
+type SensorStorage interface {
+	UpdateAndNotify(ctx context.Context, sensorName string, sensorValue bool) (bool, error)
+	GetSensorStatus(ctx context.Context, sensorName string) (SensorStatus, bool, error)
+	UpdateAvailability(ctx context.Context, sensorName string, online bool) (bool, error)
+	UpdateBridgeAvailability(ctx context.Context, bridgeName string, online bool) (bool, error)
+	ResetSensorStatus(ctx context.Context, sensorName string) error
+	SetActivated(ctx context.Context, sensorName string, kind string, activated bool, at time.Time) error
+	RecordSOSFailure(ctx context.Context, failure SOSFailure) error
+	RecordTransition(ctx context.Context, sensorName string, at time.Time, keep time.Duration) error
+	CountTransitions(ctx context.Context, sensorName string, since time.Time) (int64, error)
+	SetFlapping(ctx context.Context, sensorName string, flapping bool) (bool, error)
+	SetOpenAlert(ctx context.Context, sensorName string, at time.Time) error
+	SetBypass(ctx context.Context, bypass Bypass) error
+	GetBypass(ctx context.Context, sensorName string) (Bypass, bool, error)
+	ListBypasses(ctx context.Context) ([]Bypass, error)
+	ClearBypass(ctx context.Context, sensorName string) error
+}
+
+// SOSFailure records an alarm trigger which could not be sent to alarmManager
+type SOSFailure struct {
+	Sensor string `json:"sensor"`
+	Device string `json:"device"`
+	Mode   string `json:"mode"`
+	Target string `json:"target,omitempty"`
+	Error  string `json:"error"`
+	Time   int64  `json:"time"`
+}
+
+// Only last SOS failures are kept
+const sosFailuresKey string = "sosfailures"
+const maxSOSFailures int64 = 100
+
 type Storage struct {
 	RedisClient *goredis.Client
 }
@@ -22,8 +66,10 @@ func (storage Storage) UpdateAndNotify(ctx context.Context, sensorName string, s
 	var changed bool = false
 	var sensorStatus SensorStatus
 	now := time.Now()
-	storedSensorInfoError := storage.RedisClient.HGetAll(ctx, sensorName).Scan(&sensorStatus)
-	if storedSensorInfoError == goredis.Nil {
+	storedSensorInfoCmd := storage.RedisClient.HGetAll(ctx, sensorName)
+	storedSensorInfo, storedSensorInfoError := storedSensorInfoCmd.Result()
+	// Redis returns an empty hash for missing keys
+	if storedSensorInfoError == goredis.Nil || (storedSensorInfoError == nil && len(storedSensorInfo) == 0) {
 		//Sensor info has not been stored yet
 		sensorStatus.Name = sensorName
 		sensorStatus.LastUpdated = now.Unix()
@@ -37,6 +83,9 @@ func (storage Storage) UpdateAndNotify(ctx context.Context, sensorName string, s
 		if storedSensorInfoError != nil {
 			return changed, storedSensorInfoError
 		}
+		if scanError := storedSensorInfoCmd.Scan(&sensorStatus); scanError != nil {
+			return changed, scanError
+		}
 		// Check if Triggered value differs
 		if sensorValue != sensorStatus.Triggered {
 			changed = true
@@ -47,3 +96,265 @@ func (storage Storage) UpdateAndNotify(ctx context.Context, sensorName string, s
 	}
 	return changed, nil
 }
+
+// SetActivated stores sensor value kind, whether sensor is activated and when it changed
+func (storage Storage) SetActivated(ctx context.Context, sensorName string, kind string, activated bool, at time.Time) error {
+	return storage.RedisClient.HSet(ctx, sensorName, "activated", activated, "changedat", at.Unix(), "kind", kind).Err()
+}
+
+func (storage Storage) GetSensorStatus(ctx context.Context, sensorName string) (SensorStatus, bool, error) {
+	var sensorStatus SensorStatus
+	storedSensorInfoCmd := storage.RedisClient.HGetAll(ctx, sensorName)
+	storedSensorInfo, storedSensorInfoError := storedSensorInfoCmd.Result()
+	if storedSensorInfoError == goredis.Nil || (storedSensorInfoError == nil && len(storedSensorInfo) == 0) {
+		return sensorStatus, false, nil
+	}
+	if storedSensorInfoError != nil {
+		return sensorStatus, false, storedSensorInfoError
+	}
+	scanError := storedSensorInfoCmd.Scan(&sensorStatus)
+	return sensorStatus, true, scanError
+}
+
+// UpdateAvailability stores sensor availability, returns true if it has changed
+// Availability is only stored once sensor has sent a value, a partial sensor status would hide its first value
+func (storage Storage) UpdateAvailability(ctx context.Context, sensorName string, online bool) (bool, error) {
+	return storage.updateAvailability(ctx, sensorName, sensorName, online, false)
+}
+
+// UpdateBridgeAvailability stores coordinator availability, returns true if it has changed
+func (storage Storage) UpdateBridgeAvailability(ctx context.Context, bridgeName string, online bool) (bool, error) {
+	return storage.updateAvailability(ctx, "bridge:"+bridgeName, bridgeName, online, true)
+}
+
+func (storage Storage) updateAvailability(ctx context.Context, key string, name string, online bool, createMissing bool) (bool, error) {
+	var changed bool = false
+	var sensorStatus SensorStatus
+	storedSensorInfoCmd := storage.RedisClient.HGetAll(ctx, key)
+	storedSensorInfo, storedSensorInfoError := storedSensorInfoCmd.Result()
+	if storedSensorInfoError != nil && storedSensorInfoError != goredis.Nil {
+		return changed, storedSensorInfoError
+	}
+	stored := len(storedSensorInfo) > 0
+	if stored {
+		if scanError := storedSensorInfoCmd.Scan(&sensorStatus); scanError != nil {
+			return changed, scanError
+		}
+	}
+	// Stored offline flag matching online value means status has changed
+	if sensorStatus.Offline == online {
+		changed = true
+		if stored || createMissing {
+			storage.RedisClient.HSet(ctx, key, "name", name, "offline", !online)
+		}
+	}
+	return changed, nil
+}
+
+func (storage Storage) ResetSensorStatus(ctx context.Context, sensorName string) error {
+	return storage.RedisClient.Del(ctx, sensorName, transitionsKey(sensorName)).Err()
+}
+
+// Sensor transitions are kept in a sorted set scored by milliseconds
+func transitionsKey(sensorName string) string {
+	return "transitions:" + sensorName
+}
+
+// RecordTransition stores a sensor state change, transitions older than keep are removed
+func (storage Storage) RecordTransition(ctx context.Context, sensorName string, at time.Time, keep time.Duration) error {
+	key := transitionsKey(sensorName)
+	if addErr := storage.RedisClient.ZAdd(ctx, key, &goredis.Z{Score: float64(at.UnixMilli()), Member: strconv.FormatInt(at.UnixNano(), 10)}).Err(); addErr != nil {
+		return addErr
+	}
+	if removeErr := storage.RedisClient.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(at.Add(-keep).UnixMilli(), 10)).Err(); removeErr != nil {
+		return removeErr
+	}
+	return storage.RedisClient.Expire(ctx, key, keep).Err()
+}
+
+// CountTransitions returns how many times sensor has changed since given time
+func (storage Storage) CountTransitions(ctx context.Context, sensorName string, since time.Time) (int64, error) {
+	return storage.RedisClient.ZCount(ctx, transitionsKey(sensorName), strconv.FormatInt(since.UnixMilli(), 10), "+inf").Result()
+}
+
+// SetOpenAlert stores when last left open alert was sent
+func (storage Storage) SetOpenAlert(ctx context.Context, sensorName string, at time.Time) error {
+	return storage.RedisClient.HSet(ctx, sensorName, "openalertat", at.Unix()).Err()
+}
+
+// SetFlapping stores sensor flapping flag, returns true if it has changed
+func (storage Storage) SetFlapping(ctx context.Context, sensorName string, flapping bool) (bool, error) {
+	storedFlapping, getErr := storage.RedisClient.HGet(ctx, sensorName, "flapping").Result()
+	if getErr != nil && getErr != goredis.Nil {
+		return false, getErr
+	}
+	if (storedFlapping == "1") == flapping {
+		return false, nil
+	}
+	return true, storage.RedisClient.HSet(ctx, sensorName, "flapping", flapping).Err()
+}
+
+type AlarmModeStatus struct {
+	Mode        string `redis:"mode"`
+	LastUpdated int64  `redis:"lastupdated"`
+}
+
+func alarmModeKey(deviceID string) string {
+	return "alarmmode:" + deviceID
+}
+
+func (storage Storage) StoreAlarmMode(ctx context.Context, deviceID string, mode string) error {
+	return storage.RedisClient.HSet(ctx, alarmModeKey(deviceID), "mode", mode, "lastupdated", time.Now().Unix()).Err()
+}
+
+// GetAlarmMode returns last known alarm mode of device
+func (storage Storage) GetAlarmMode(ctx context.Context, deviceID string) (string, bool, error) {
+	var alarmModeStatus AlarmModeStatus
+	storedModeError := storage.RedisClient.HGetAll(ctx, alarmModeKey(deviceID)).Scan(&alarmModeStatus)
+	if storedModeError == goredis.Nil {
+		return "", false, nil
+	}
+	if storedModeError != nil {
+		return "", false, storedModeError
+	}
+	return alarmModeStatus.Mode, alarmModeStatus.Mode != "", nil
+}
+
+func (storage Storage) RecordSOSFailure(ctx context.Context, failure SOSFailure) error {
+	encodedFailure, _ := json.Marshal(failure)
+	if pushErr := storage.RedisClient.LPush(ctx, sosFailuresKey, encodedFailure).Err(); pushErr != nil {
+		return pushErr
+	}
+	return storage.RedisClient.LTrim(ctx, sosFailuresKey, 0, maxSOSFailures-1).Err()
+}
+
+// NotificationWindow counts notifications of a sensor and event type within a rate limit window
+type NotificationWindow struct {
+	Sensor      string `redis:"sensor"`
+	EventType   string `redis:"eventtype"`
+	Start       int64  `redis:"start"`
+	Count       int64  `redis:"count"`
+	Suppressed  int64  `redis:"suppressed"`
+	LastMessage string `redis:"lastmessage"`
+	LastSent    int64  `redis:"lastsent"`
+}
+
+// Keys of every stored notification window are kept in a set
+const notificationWindowsKey string = "notificationwindows"
+
+func notificationWindowKey(key string) string {
+	return "notificationwindow:" + key
+}
+
+func (storage Storage) GetNotificationWindow(ctx context.Context, key string) (NotificationWindow, bool, error) {
+	var window NotificationWindow
+	storedWindowCmd := storage.RedisClient.HGetAll(ctx, notificationWindowKey(key))
+	storedWindow, storedWindowError := storedWindowCmd.Result()
+	if storedWindowError == goredis.Nil || (storedWindowError == nil && len(storedWindow) == 0) {
+		return window, false, nil
+	}
+	if storedWindowError != nil {
+		return window, false, storedWindowError
+	}
+	scanError := storedWindowCmd.Scan(&window)
+	return window, true, scanError
+}
+
+func (storage Storage) StoreNotificationWindow(ctx context.Context, key string, window NotificationWindow) error {
+	if addErr := storage.RedisClient.SAdd(ctx, notificationWindowsKey, key).Err(); addErr != nil {
+		return addErr
+	}
+	return storage.RedisClient.HSet(ctx, notificationWindowKey(key), "sensor", window.Sensor, "eventtype", window.EventType, "start", window.Start, "count", window.Count, "suppressed", window.Suppressed, "lastmessage", window.LastMessage, "lastsent", window.LastSent).Err()
+}
+
+func (storage Storage) NotificationWindowKeys(ctx context.Context) ([]string, error) {
+	return storage.RedisClient.SMembers(ctx, notificationWindowsKey).Result()
+}
+
+func (storage Storage) DeleteNotificationWindow(ctx context.Context, key string) error {
+	if delErr := storage.RedisClient.Del(ctx, notificationWindowKey(key)).Err(); delErr != nil {
+		return delErr
+	}
+	return storage.RedisClient.SRem(ctx, notificationWindowsKey, key).Err()
+}
+
+// Bypass excludes a sensor from triggering alarm until a time or until next disarm
+type Bypass struct {
+	Sensor      string `redis:"sensor" json:"sensor"`
+	Until       int64  `redis:"until" json:"until,omitempty"`
+	UntilDisarm bool   `redis:"untildisarm" json:"until_disarm"`
+	Created     int64  `redis:"created" json:"created"`
+}
+
+// Active returns false once bypass time has passed
+func (bypass Bypass) Active(now time.Time) bool {
+	return bypass.UntilDisarm || bypass.Until > now.Unix()
+}
+
+// Bypassed sensors are kept in a set
+const bypassesKey string = "bypasses"
+
+func bypassKey(sensorName string) string {
+	return "bypass:" + sensorName
+}
+
+func (storage Storage) SetBypass(ctx context.Context, bypass Bypass) error {
+	key := bypassKey(bypass.Sensor)
+	if addErr := storage.RedisClient.SAdd(ctx, bypassesKey, bypass.Sensor).Err(); addErr != nil {
+		return addErr
+	}
+	if setErr := storage.RedisClient.HSet(ctx, key, "sensor", bypass.Sensor, "until", bypass.Until, "untildisarm", bypass.UntilDisarm, "created", bypass.Created).Err(); setErr != nil {
+		return setErr
+	}
+	// Timed bypasses are removed by Redis
+	if bypass.UntilDisarm {
+		return storage.RedisClient.Persist(ctx, key).Err()
+	}
+	return storage.RedisClient.ExpireAt(ctx, key, time.Unix(bypass.Until, 0)).Err()
+}
+
+// GetBypass returns sensor bypass, expired bypasses are not returned
+func (storage Storage) GetBypass(ctx context.Context, sensorName string) (Bypass, bool, error) {
+	var bypass Bypass
+	storedBypassCmd := storage.RedisClient.HGetAll(ctx, bypassKey(sensorName))
+	storedBypass, storedBypassError := storedBypassCmd.Result()
+	if storedBypassError == goredis.Nil || (storedBypassError == nil && len(storedBypass) == 0) {
+		return bypass, false, nil
+	}
+	if storedBypassError != nil {
+		return bypass, false, storedBypassError
+	}
+	if scanError := storedBypassCmd.Scan(&bypass); scanError != nil {
+		return bypass, false, scanError
+	}
+	return bypass, bypass.Active(time.Now()), nil
+}
+
+// ListBypasses returns active bypasses
+func (storage Storage) ListBypasses(ctx context.Context) ([]Bypass, error) {
+	var bypasses []Bypass
+	sensorNames, membersErr := storage.RedisClient.SMembers(ctx, bypassesKey).Result()
+	if membersErr != nil {
+		return bypasses, membersErr
+	}
+	for _, sensorName := range sensorNames {
+		bypass, found, bypassErr := storage.GetBypass(ctx, sensorName)
+		if bypassErr != nil {
+			return bypasses, bypassErr
+		}
+		if !found {
+			storage.RedisClient.SRem(ctx, bypassesKey, sensorName)
+			continue
+		}
+		bypasses = append(bypasses, bypass)
+	}
+	sort.Slice(bypasses, func(i, j int) bool { return bypasses[i].Sensor < bypasses[j].Sensor })
+	return bypasses, nil
+}
+
+func (storage Storage) ClearBypass(ctx context.Context, sensorName string) error {
+	if delErr := storage.RedisClient.Del(ctx, bypassKey(sensorName)).Err(); delErr != nil {
+		return delErr
+	}
+	return storage.RedisClient.SRem(ctx, bypassesKey, sensorName).Err()
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"testing"
+	"time"
 
 	redismock "github.com/go-redis/redismock/v8"
 )
@@ -73,3 +74,287 @@ func TestChanged(t *testing.T) {
 	}
 
 }
+
+func TestAvailabilityOffline(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	var key string = "ab123"
+	mock.ExpectHGetAll(key).RedisNil()
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	changed, err := storageInstance.UpdateAvailability(ctx, key, false)
+	if err != nil {
+		t.Error("TestAvailabilityOffline, should not fail, error was ", err.Error())
+	}
+	if changed != true {
+		t.Error("TestAvailabilityOffline, changed should be true as sensor was not flagged as offline.")
+	}
+}
+
+func TestAvailabilityOfflineStoredSensor(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	expectedValues := make(map[string]string)
+	expectedValues["name"] = "ab123"
+	expectedValues["lastupdated"] = "123"
+	expectedValues["triggered"] = "false"
+
+	var key string = "ab123"
+	mock.ExpectHGetAll(key).SetVal(expectedValues)
+	mock.ExpectHSet(key, "name", key, "offline", true).SetVal(1)
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	changed, err := storageInstance.UpdateAvailability(ctx, key, false)
+	if err != nil {
+		t.Error("TestAvailabilityOfflineStoredSensor, should not fail, error was ", err.Error())
+	}
+	if changed != true {
+		t.Error("TestAvailabilityOfflineStoredSensor, changed should be true as sensor was not flagged as offline.")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error("TestAvailabilityOfflineStoredSensor, unexpected redis commands: ", err.Error())
+	}
+}
+
+func TestAvailabilityAlreadyOnline(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	expectedValues := make(map[string]string)
+	expectedValues["name"] = "ab123"
+	expectedValues["lastupdated"] = "123"
+	expectedValues["triggered"] = "false"
+
+	var key string = "ab123"
+	mock.ExpectHGetAll(key).SetVal(expectedValues)
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	changed, err := storageInstance.UpdateAvailability(ctx, key, true)
+	if err != nil {
+		t.Error("TestAvailabilityAlreadyOnline, should not fail, error was ", err.Error())
+	}
+	if changed != false {
+		t.Error("TestAvailabilityAlreadyOnline, changed should be false as sensor was online.")
+	}
+}
+
+func TestGetSensorStatus(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	expectedValues := make(map[string]string)
+	expectedValues["name"] = "ab123"
+	expectedValues["lastupdated"] = "123"
+	expectedValues["triggered"] = "true"
+	expectedValues["offline"] = "true"
+
+	var key string = "ab123"
+	mock.ExpectHGetAll(key).SetVal(expectedValues)
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	sensorStatus, found, err := storageInstance.GetSensorStatus(ctx, key)
+	if err != nil {
+		t.Error("TestGetSensorStatus, should not fail, error was ", err.Error())
+	}
+	if found != true {
+		t.Error("TestGetSensorStatus, sensor should be found.")
+	}
+	if sensorStatus.LastUpdated != 123 || sensorStatus.Triggered != true || sensorStatus.Offline != true {
+		t.Errorf("TestGetSensorStatus, unexpected status %+v.", sensorStatus)
+	}
+}
+
+func TestResetSensorStatus(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	var key string = "ab123"
+	mock.ExpectDel(key, "transitions:"+key).SetVal(1)
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	if err := storageInstance.ResetSensorStatus(ctx, key); err != nil {
+		t.Error("TestResetSensorStatus, should not fail, error was ", err.Error())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error("TestResetSensorStatus, sensor key should be deleted: ", err.Error())
+	}
+}
+
+func TestSetActivated(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	mock.ExpectHSet("door1", "activated", true, "changedat", int64(123), "kind", "contact").SetVal(3)
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	if err := storageInstance.SetActivated(ctx, "door1", "contact", true, time.Unix(123, 0)); err != nil {
+		t.Error("TestSetActivated, should not fail, error was ", err.Error())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error("TestSetActivated, unexpected redis commands: ", err.Error())
+	}
+}
+
+func TestGetAlarmMode(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	expectedValues := make(map[string]string)
+	expectedValues["mode"] = "armed"
+	expectedValues["lastupdated"] = "123"
+
+	mock.ExpectHGetAll("alarmmode:1").SetVal(expectedValues)
+	mock.ExpectHGetAll("alarmmode:2").RedisNil()
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	mode, found, err := storageInstance.GetAlarmMode(ctx, "1")
+	if err != nil {
+		t.Error("TestGetAlarmMode, should not fail, error was ", err.Error())
+	}
+	if found != true || mode != "armed" {
+		t.Errorf("TestGetAlarmMode, mode should be armed. Returned: %s, %t.", mode, found)
+	}
+	if _, found, _ := storageInstance.GetAlarmMode(ctx, "2"); found != false {
+		t.Error("TestGetAlarmMode, device 2 mode should not be found.")
+	}
+}
+
+func TestRecordSOSFailure(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	failure := SOSFailure{Sensor: "door1", Device: "1", Mode: "armed", Error: "connection refused", Time: 123}
+	mock.ExpectLPush("sosfailures", []byte(`{"sensor":"door1","device":"1","mode":"armed","error":"connection refused","time":123}`)).SetVal(1)
+	mock.ExpectLTrim("sosfailures", 0, 99).SetVal("OK")
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	if err := storageInstance.RecordSOSFailure(ctx, failure); err != nil {
+		t.Error("TestRecordSOSFailure, should not fail, error was ", err.Error())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error("TestRecordSOSFailure, failure should be pushed and list trimmed: ", err.Error())
+	}
+}
+
+func TestNotificationWindow(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	window := NotificationWindow{Sensor: "door1", EventType: "sensor_status", Start: 100, Count: 3, Suppressed: 1, LastMessage: "door1 is open", LastSent: 110}
+	mock.ExpectSAdd("notificationwindows", "door1:sensor_status").SetVal(1)
+	mock.ExpectHSet("notificationwindow:door1:sensor_status", "sensor", "door1", "eventtype", "sensor_status", "start", int64(100), "count", int64(3), "suppressed", int64(1), "lastmessage", "door1 is open", "lastsent", int64(110)).SetVal(7)
+	mock.ExpectHGetAll("notificationwindow:door1:sensor_status").SetVal(map[string]string{"sensor": "door1", "eventtype": "sensor_status", "start": "100", "count": "3", "suppressed": "1", "lastmessage": "door1 is open", "lastsent": "110"})
+	mock.ExpectDel("notificationwindow:door1:sensor_status").SetVal(1)
+	mock.ExpectSRem("notificationwindows", "door1:sensor_status").SetVal(1)
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	if err := storageInstance.StoreNotificationWindow(ctx, "door1:sensor_status", window); err != nil {
+		t.Error("TestNotificationWindow, store should not fail, error was ", err.Error())
+	}
+	storedWindow, found, err := storageInstance.GetNotificationWindow(ctx, "door1:sensor_status")
+	if err != nil || !found || storedWindow != window {
+		t.Errorf("TestNotificationWindow, unexpected stored window %+v, %t, %v.", storedWindow, found, err)
+	}
+	if err := storageInstance.DeleteNotificationWindow(ctx, "door1:sensor_status"); err != nil {
+		t.Error("TestNotificationWindow, delete should not fail, error was ", err.Error())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error("TestNotificationWindow, unexpected redis commands: ", err.Error())
+	}
+}
+
+func TestSetFlapping(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	mock.ExpectHGet("door1", "flapping").RedisNil()
+	mock.ExpectHSet("door1", "flapping", true).SetVal(1)
+	mock.ExpectHGet("door1", "flapping").SetVal("1")
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	changed, err := storageInstance.SetFlapping(ctx, "door1", true)
+	if err != nil || changed != true {
+		t.Errorf("TestSetFlapping, flapping flag should change. Returned: %t, %v.", changed, err)
+	}
+	changed, err = storageInstance.SetFlapping(ctx, "door1", true)
+	if err != nil || changed != false {
+		t.Errorf("TestSetFlapping, flapping flag should not change. Returned: %t, %v.", changed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error("TestSetFlapping, unexpected redis commands: ", err.Error())
+	}
+}
+
+func TestBypass(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+
+	bypass := Bypass{Sensor: "window1", UntilDisarm: true, Created: 100}
+	mock.ExpectSAdd("bypasses", "window1").SetVal(1)
+	mock.ExpectHSet("bypass:window1", "sensor", "window1", "until", int64(0), "untildisarm", true, "created", int64(100)).SetVal(4)
+	mock.ExpectPersist("bypass:window1").SetVal(false)
+	mock.ExpectHGetAll("bypass:window1").SetVal(map[string]string{"sensor": "window1", "until": "0", "untildisarm": "1", "created": "100"})
+	mock.ExpectHGetAll("bypass:door1").SetVal(map[string]string{"sensor": "door1", "until": "50", "untildisarm": "0", "created": "10"})
+
+	storageInstance := Storage{db}
+	var ctx = context.TODO()
+
+	if err := storageInstance.SetBypass(ctx, bypass); err != nil {
+		t.Error("TestBypass, set should not fail, error was ", err.Error())
+	}
+	storedBypass, found, err := storageInstance.GetBypass(ctx, "window1")
+	if err != nil || !found || storedBypass != bypass {
+		t.Errorf("TestBypass, unexpected stored bypass %+v, %t, %v.", storedBypass, found, err)
+	}
+	if _, found, _ := storageInstance.GetBypass(ctx, "door1"); found {
+		t.Error("TestBypass, expired bypass should not be found.")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error("TestBypass, unexpected redis commands: ", err.Error())
+	}
+}
+
+func TestUpdateAndNotifyStoragesMatch(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	var key string = "door1"
+	// Redis mock answers what a real server stores after each value
+	mock.ExpectHGetAll(key).SetVal(map[string]string{})
+	mock.ExpectHSet(key, "name", key).SetVal(1)
+	mock.Regexp().ExpectHSet(key, "lastupdated", `^\d+$`).SetVal(1)
+	mock.ExpectHSet(key, "triggered", false).SetVal(1)
+	mock.ExpectHGetAll(key).SetVal(map[string]string{"name": key, "lastupdated": "123", "triggered": "0"})
+	mock.Regexp().ExpectHSet(key, "lastupdated", `^\d+$`).SetVal(0)
+	mock.ExpectHGetAll(key).SetVal(map[string]string{"name": key, "lastupdated": "123", "triggered": "0"})
+	mock.ExpectHSet(key, "triggered", true).SetVal(0)
+	mock.Regexp().ExpectHSet(key, "lastupdated", `^\d+$`).SetVal(0)
+	mock.ExpectHGetAll(key).SetVal(map[string]string{"name": key, "lastupdated": "123", "triggered": "1"})
+	mock.Regexp().ExpectHSet(key, "lastupdated", `^\d+$`).SetVal(0)
+
+	storages := map[string]SensorStorage{"redis": Storage{db}, "memory": NewMemoryStorage()}
+	values := []bool{false, false, true, true}
+	expectedChanges := []bool{true, false, true, false}
+	var ctx = context.TODO()
+
+	for storageName, storageInstance := range storages {
+		for i, value := range values {
+			changed, err := storageInstance.UpdateAndNotify(ctx, key, value)
+			if err != nil || changed != expectedChanges[i] {
+				t.Errorf("TestUpdateAndNotifyStoragesMatch, %s storage value %d changed should be %t. Returned: %t, %v.", storageName, i, expectedChanges[i], changed, err)
+			}
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error("TestUpdateAndNotifyStoragesMatch, unexpected redis commands: ", err.Error())
+	}
+}